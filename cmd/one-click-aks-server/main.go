@@ -7,6 +7,7 @@ import (
 	"one-click-aks-server/internal/config"
 	"one-click-aks-server/internal/handler"
 	"one-click-aks-server/internal/logger"
+	"time"
 
 	"one-click-aks-server/internal/middleware"
 	"one-click-aks-server/internal/repository"
@@ -40,21 +41,26 @@ func main() {
 	rdb := cache.NewRedisClient()
 
 	// repositories
-	logStreamRepository := repository.NewLogStreamRepository()
+	logStreamRepository := repository.NewLogStreamRepository(appConfig, rdb)
 	actionStatusRepository := repository.NewActionStatusRepository()
 	redisRepository := repository.NewRedisRepository()
 	authRepository := repository.NewAuthRepository(appConfig, auth, rdb)
 	storageAccountRepository := repository.NewStorageAccountRepository(auth, rdb, appConfig)
 	workspaceRepository := repository.NewTfWorkspaceRepository(appConfig)
+	if appConfig.WorkspaceRepository == "blob" {
+		workspaceRepository = repository.NewBlobWorkspaceRepository(appConfig, auth)
+	}
 	prefRepository := repository.NewPreferenceRepository(auth, appConfig)
 	kVersionRepository := repository.NewKVersionRepository(appConfig, auth, rdb)
 	labRepository := repository.NewLabRepository(appConfig, auth)
 	terraformRepository := repository.NewTerraformRepository(appConfig)
 	deploymentRepository := repository.NewDeploymentRepository(appConfig, auth, rdb)
+	operationRepository := repository.NewOperationRepository(appConfig, rdb)
 
 	// services
 	logStreamService := service.NewLogStreamService(logStreamRepository)
 	actionStatusService := service.NewActionStatusService(actionStatusRepository)
+	operationService := service.NewOperationService(operationRepository)
 	redisService := service.NewRedisService(redisRepository)
 	authService := service.NewAuthService(authRepository)
 	storageAccountService := service.NewStorageAccountService(storageAccountRepository)
@@ -62,8 +68,8 @@ func main() {
 	prefService := service.NewPreferenceService(prefRepository, storageAccountService)
 	kVersionService := service.NewKVersionService(kVersionRepository, prefService)
 	labService := service.NewLabService(labRepository, kVersionService, storageAccountService, authService)
-	terraformService := service.NewTerraformService(terraformRepository, labService, workspaceService, logStreamService, actionStatusService, kVersionService, storageAccountService, authService)
-	deploymentService := service.NewDeploymentService(deploymentRepository, labService, terraformService, actionStatusService, logStreamService, authService, workspaceService, *appConfig)
+	terraformService := service.NewTerraformService(terraformRepository, labService, workspaceService, logStreamService, actionStatusService, kVersionService, storageAccountService, authService, operationService, appConfig)
+	deploymentService := service.NewDeploymentService(deploymentRepository, labService, terraformService, actionStatusService, logStreamService, authService, workspaceService, storageAccountService, *appConfig)
 
 	// gin routers
 	router := gin.Default()
@@ -85,9 +91,6 @@ func main() {
 	authWithActionRouter := authRouter.Group("/")
 	authWithActionRouter.Use(middleware.ActionStatusMiddleware(actionStatusService))
 
-	authWithTerraformActionRouter := authRouter.Group("/")
-	authWithTerraformActionRouter.Use(middleware.TerraformActionMiddleware(actionStatusService))
-
 	// server status
 	router.GET("/status", status)
 
@@ -98,22 +101,31 @@ func main() {
 	// handler.NewLoginHandler(router, authService)
 	handler.NewAuthActionStatusHandler(authRouter, actionStatusService)
 	handler.NewAuthHandler(authRouter, authService)
+	handler.NewOperationHandler(authRouter, operationService)
+	handler.NewTerraformHandler(authRouter, terraformService, actionStatusService, deploymentService, operationService, labService)
 	// handler.NewAuthWithActionStatusHandler(authWithActionRouter, authService)
-	// handler.NewStorageAccountHandler(authRouter, storageAccountService)
-	handler.NewStorageAccountWithActionStatusHandler(authWithActionRouter, storageAccountService)
-	handler.NewWorkspaceHandler(authRouter, workspaceService)
+	handler.NewStorageAccountHandler(authRouter, storageAccountService, actionStatusService)
+	handler.NewStorageAccountWithActionStatusHandler(authWithActionRouter, storageAccountService, workspaceService)
+	handler.NewWorkspaceHandler(authRouter, workspaceService, deploymentService)
+	handler.NewWorkspaceWithActionStatusHandler(authWithActionRouter, workspaceService, deploymentService)
 	handler.NewPreferenceHandler(authRouter, prefService)
 	handler.NewKVersionHandler(authRouter, kVersionService)
-	handler.NewLabHandler(authRouter, labService)
-	handler.NewDeploymentHandler(authRouter, deploymentService, terraformService, actionStatusService)
-	handler.NewDeploymentWithActionStatusHandler(authWithActionRouter, deploymentService, terraformService, actionStatusService)
-	handler.NewDeploymentWithTerraformActionStatusHandler(authWithTerraformActionRouter, deploymentService, terraformService, actionStatusService)
-	handler.NewTerraformWithActionStatusHandler(authWithTerraformActionRouter, terraformService, actionStatusService, deploymentService)
+	handler.NewLabHandler(authRouter, labService, appConfig.StrictLabBinding)
+	handler.NewDeploymentHandler(authRouter, deploymentService, terraformService, actionStatusService, appConfig.StrictLabBinding)
+	handler.NewDeploymentWithActionStatusHandler(authWithActionRouter, deploymentService, terraformService, actionStatusService, appConfig.StrictLabBinding)
+	// terraform actions lock the workspace they run against.
+	handler.NewDeploymentWithTerraformActionStatusHandler(authRouter, deploymentService, terraformService, actionStatusService, operationService)
+	handler.NewTerraformWithActionStatusHandler(authRouter, terraformService, actionStatusService, deploymentService, operationService, labService, appConfig.StrictLabBinding)
 
 	// go routine to poll and delete deployments.
 	// take seconds and multiply with 1000000000 and pass it to the function.
 	go deploymentService.PollAndDeleteDeployments(60 * 1000000000)
 
+	// go routine to check deployments for drift, disabled if interval is 0.
+	if appConfig.DriftCheckIntervalMinutes > 0 {
+		go deploymentService.PollAndDetectDrift(time.Duration(appConfig.DriftCheckIntervalMinutes) * time.Minute)
+	}
+
 	// run server
 	router.Run()
 }
@@ -11,11 +11,19 @@ require (
 	github.com/golang-jwt/jwt v3.2.2+incompatible
 	github.com/google/uuid v1.4.0
 	github.com/gorilla/websocket v1.5.1
+	github.com/hashicorp/hcl/v2 v2.17.0
 	github.com/lestrrat-go/jwx v1.2.27
 	github.com/redis/go-redis/v9 v9.3.0
+	github.com/zclconf/go-cty v1.13.0
 	golang.org/x/exp v0.0.0-20231206192017-f3f8817b8deb
 )
 
+require (
+	github.com/agext/levenshtein v1.2.1 // indirect
+	github.com/apparentlymart/go-textseg/v13 v13.0.0 // indirect
+	github.com/mitchellh/go-wordwrap v0.0.0-20150314170334-ad45545899c7 // indirect
+)
+
 require (
 	github.com/Azure/azure-sdk-for-go/sdk/azcore v1.9.0
 	github.com/Azure/azure-sdk-for-go/sdk/internal v1.5.0 // indirect
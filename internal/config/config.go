@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 	"golang.org/x/exp/slog"
@@ -27,6 +28,19 @@ type Config struct {
 	ActlabsHubURL                   string
 	HttpRequestTimeoutSeconds       int
 	UserAlias                       string
+	OperationHistoryLimit           int
+	CancelGracePeriodSeconds        int
+	LogStreamHistoryLimit           int
+	DriftCheckIntervalMinutes       int
+	OperationTimeoutMinutes         map[string]int // keyed by action, or extend-<mode> for extend modes.
+	RetryMaxAttempts                int
+	RetryBackoffSeconds             int
+	RetryErrorPatterns              []string
+	StateLockStaleMinutes           int
+	StateLockAutoBreak              bool
+	PlanExpiryMinutes               int
+	WorkspaceRepository             string
+	StrictLabBinding                bool
 	// Add other configuration fields as needed
 }
 
@@ -169,6 +183,162 @@ func NewConfig() *Config {
 	}
 	slog.Info("USER_ALIAS: " + userAlias)
 
+	operationHistoryLimitStr := os.Getenv("OPERATION_HISTORY_LIMIT")
+	operationHistoryLimit := 100 // default value
+	if operationHistoryLimitStr != "" {
+		var err error
+		operationHistoryLimit, err = strconv.Atoi(operationHistoryLimitStr)
+		if err != nil {
+			log.Fatalf("Invalid value for OPERATION_HISTORY_LIMIT: %v", err)
+		}
+	}
+
+	cancelGracePeriodSecondsStr := os.Getenv("CANCEL_GRACE_PERIOD_SECONDS")
+	cancelGracePeriodSeconds := 60 // default value
+	if cancelGracePeriodSecondsStr != "" {
+		var err error
+		cancelGracePeriodSeconds, err = strconv.Atoi(cancelGracePeriodSecondsStr)
+		if err != nil {
+			log.Fatalf("Invalid value for CANCEL_GRACE_PERIOD_SECONDS: %v", err)
+		}
+	}
+
+	logStreamHistoryLimitStr := os.Getenv("LOG_STREAM_HISTORY_LIMIT")
+	logStreamHistoryLimit := 20 // default value
+	if logStreamHistoryLimitStr != "" {
+		var err error
+		logStreamHistoryLimit, err = strconv.Atoi(logStreamHistoryLimitStr)
+		if err != nil {
+			log.Fatalf("Invalid value for LOG_STREAM_HISTORY_LIMIT: %v", err)
+		}
+	}
+
+	// 0 disables drift detection.
+	driftCheckIntervalMinutesStr := os.Getenv("DRIFT_CHECK_INTERVAL_MINUTES")
+	driftCheckIntervalMinutes := 60 // default value
+	if driftCheckIntervalMinutesStr != "" {
+		var err error
+		driftCheckIntervalMinutes, err = strconv.Atoi(driftCheckIntervalMinutesStr)
+		if err != nil {
+			log.Fatalf("Invalid value for DRIFT_CHECK_INTERVAL_MINUTES: %v", err)
+		}
+	}
+
+	// Deadlines per action, 0 disables the deadline.
+	// Set with OPERATION_TIMEOUT_<ACTION>_MINUTES, extend modes can be set with
+	// OPERATION_TIMEOUT_EXTEND_<MODE>_MINUTES and default to extend's deadline.
+	operationTimeoutMinutes := map[string]int{
+		"init":    30,
+		"plan":    30,
+		"apply":   120,
+		"destroy": 120,
+		"extend":  60,
+		"drift":   30,
+	}
+	for _, env := range os.Environ() {
+		key, val, _ := strings.Cut(env, "=")
+		if !strings.HasPrefix(key, "OPERATION_TIMEOUT_") || !strings.HasSuffix(key, "_MINUTES") {
+			continue
+		}
+		action := strings.TrimSuffix(strings.TrimPrefix(key, "OPERATION_TIMEOUT_"), "_MINUTES")
+		action = strings.ReplaceAll(strings.ToLower(action), "_", "-")
+		minutes, err := strconv.Atoi(val)
+		if err != nil {
+			log.Fatalf("Invalid value for %s: %v", key, err)
+		}
+		operationTimeoutMinutes[action] = minutes
+	}
+
+	// Terraform actions failing with one of the patterns in output are retried.
+	// Backoff doubles after each attempt.
+	retryMaxAttemptsStr := os.Getenv("RETRY_MAX_ATTEMPTS")
+	retryMaxAttempts := 3 // default value
+	if retryMaxAttemptsStr != "" {
+		var err error
+		retryMaxAttempts, err = strconv.Atoi(retryMaxAttemptsStr)
+		if err != nil {
+			log.Fatalf("Invalid value for RETRY_MAX_ATTEMPTS: %v", err)
+		}
+	}
+
+	retryBackoffSecondsStr := os.Getenv("RETRY_BACKOFF_SECONDS")
+	retryBackoffSeconds := 30 // default value
+	if retryBackoffSecondsStr != "" {
+		var err error
+		retryBackoffSeconds, err = strconv.Atoi(retryBackoffSecondsStr)
+		if err != nil {
+			log.Fatalf("Invalid value for RETRY_BACKOFF_SECONDS: %v", err)
+		}
+	}
+
+	// State lock isn't one of them, lease on state blob never expires. It's retried only
+	// after the lease is broken, see STATE_LOCK_AUTO_BREAK.
+	retryErrorPatterns := []string{
+		"StatusCode=429",
+		"TooManyRequests",
+		"AnotherOperationInProgress",
+	}
+	if retryErrorPatternsStr := os.Getenv("RETRY_ERROR_PATTERNS"); retryErrorPatternsStr != "" {
+		retryErrorPatterns = []string{}
+		for _, pattern := range strings.Split(retryErrorPatternsStr, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern != "" {
+				retryErrorPatterns = append(retryErrorPatterns, pattern)
+			}
+		}
+	}
+	slog.Info("RETRY_ERROR_PATTERNS: " + strings.Join(retryErrorPatterns, ","))
+
+	// Lease on state blob older than this is considered stale when terraform can't acquire the state lock.
+	stateLockStaleMinutesStr := os.Getenv("STATE_LOCK_STALE_MINUTES")
+	stateLockStaleMinutes := 60 // default value
+	if stateLockStaleMinutesStr != "" {
+		var err error
+		stateLockStaleMinutes, err = strconv.Atoi(stateLockStaleMinutesStr)
+		if err != nil {
+			log.Fatalf("Invalid value for STATE_LOCK_STALE_MINUTES: %v", err)
+		}
+	}
+
+	// Stale lease is broken by server if true, otherwise user is told how to break it.
+	stateLockAutoBreak := false
+	if os.Getenv("STATE_LOCK_AUTO_BREAK") == "true" {
+		slog.Info("STATE_LOCK_AUTO_BREAK: true")
+		stateLockAutoBreak = true
+	} else {
+		slog.Info("STATE_LOCK_AUTO_BREAK: false")
+	}
+
+	// Saved plans older than this can't be applied and their files are removed.
+	planExpiryMinutesStr := os.Getenv("PLAN_EXPIRY_MINUTES")
+	planExpiryMinutes := 1440 // default value
+	if planExpiryMinutesStr != "" {
+		var err error
+		planExpiryMinutes, err = strconv.Atoi(planExpiryMinutesStr)
+		if err != nil {
+			log.Fatalf("Invalid value for PLAN_EXPIRY_MINUTES: %v", err)
+		}
+	}
+	slog.Info("PLAN_EXPIRY_MINUTES: " + strconv.Itoa(planExpiryMinutes))
+
+	// Request bodies carrying a lab are rejected if they have fields lab doesn't know.
+	strictLabBinding := false
+	if os.Getenv("STRICT_LAB_BINDING") == "true" {
+		slog.Info("STRICT_LAB_BINDING: true")
+		strictLabBinding = true
+	} else {
+		slog.Info("STRICT_LAB_BINDING: false")
+	}
+
+	// Workspaces are listed by running terraform with "script", or from state blobs with "blob".
+	workspaceRepository := os.Getenv("WORKSPACE_REPOSITORY")
+	if workspaceRepository == "" {
+		workspaceRepository = "script" // default value
+	}
+	if workspaceRepository != "script" && workspaceRepository != "blob" {
+		log.Fatalf("Invalid value for WORKSPACE_REPOSITORY: %s, must be script or blob", workspaceRepository)
+	}
+	slog.Info("WORKSPACE_REPOSITORY: " + workspaceRepository)
+
 	// Retrieve other environment variables and check them as needed
 
 	return &Config{
@@ -189,6 +359,19 @@ func NewConfig() *Config {
 		ActlabsHubURL:                   actlabsHubURL,
 		HttpRequestTimeoutSeconds:       httpRequestTimeoutSeconds,
 		UserAlias:                       userAlias,
+		OperationHistoryLimit:           operationHistoryLimit,
+		CancelGracePeriodSeconds:        cancelGracePeriodSeconds,
+		LogStreamHistoryLimit:           logStreamHistoryLimit,
+		DriftCheckIntervalMinutes:       driftCheckIntervalMinutes,
+		OperationTimeoutMinutes:         operationTimeoutMinutes,
+		RetryMaxAttempts:                retryMaxAttempts,
+		RetryBackoffSeconds:             retryBackoffSeconds,
+		RetryErrorPatterns:              retryErrorPatterns,
+		StateLockStaleMinutes:           stateLockStaleMinutes,
+		StateLockAutoBreak:              stateLockAutoBreak,
+		PlanExpiryMinutes:               planExpiryMinutes,
+		WorkspaceRepository:             workspaceRepository,
+		StrictLabBinding:                strictLabBinding,
 		// Set other fields
 	}
 }
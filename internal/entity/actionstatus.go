@@ -1,7 +1,14 @@
 package entity
 
+import "errors"
+
+// Returned when lock can't be acquired because an action is already in progress.
+var ErrActionInProgress = errors.New("action in progress")
+
+// InProgress is true while any action lock is held.
 type ActionStatus struct {
-	InProgress bool `json:"inProgress"`
+	InProgress bool     `json:"inProgress"`
+	Workspaces []string `json:"workspaces"` // workspaces with an action in progress.
 }
 
 type TerraformOperation struct {
@@ -30,8 +37,21 @@ type ServerNotification struct {
 type ActionStatusService interface {
 	GetActionStatus() (ActionStatus, error)
 	SetActionStatus(ActionStatus) error
+
+	// Locks the whole server, fails with ErrActionInProgress if any lock is held.
 	SetActionStart() error
 	SetActionEnd() error
+
+	// Locks the workspace for the operation, fails with ErrActionInProgress if the
+	// workspace or the whole server is locked. Actions on different workspaces
+	// can run in parallel. Empty workspace locks the whole server.
+	AcquireActionLock(workspace string, operationId string) error
+	ReleaseActionLock(workspace string) error
+
+	// Operation holding the lock on the workspace, or on the whole server, and whether
+	// either is locked. Operation id is empty for the server wide lock of SetActionStart.
+	GetActionLockOperationId(workspace string) (string, bool, error)
+
 	WaitForActionStatusChange() (ActionStatus, error)
 
 	SetTerraformOperation(TerraformOperation) error
@@ -48,6 +68,12 @@ type ActionStatusRepository interface {
 	SetActionStatus(string) error
 	WaitForActionStatusChange() (string, error)
 
+	// Action locks are kept as workspace to operation id.
+	AcquireActionLock(workspace string, operationId string) (bool, error)
+	ReleaseActionLock(workspace string) error
+	GetActionLocks() (map[string]string, error)
+	DeleteActionLocks() error
+
 	SetTerraformOperation(string) error
 	GetTerraformOperation() (string, error)
 	WaitForTerraformOperationChange() (string, error)
@@ -12,16 +12,32 @@ const (
 	InitInProgress       DeploymentStatus = "Init In Progress"
 	InitFailed           DeploymentStatus = "Init Failed"
 	InitCompleted        DeploymentStatus = "Init Completed"
+	InitCancelled        DeploymentStatus = "Init Cancelled"
 	PlanInProgress       DeploymentStatus = "Plan In Progress"
 	PlanFailed           DeploymentStatus = "Plan Failed"
 	PlanCompleted        DeploymentStatus = "Plan Completed"
+	PlanCancelled        DeploymentStatus = "Plan Cancelled"
 	DeploymentInProgress DeploymentStatus = "Deployment In Progress"
 	DeploymentFailed     DeploymentStatus = "Deployment Failed"
 	DeploymentCompleted  DeploymentStatus = "Deployment Completed"
+	DeploymentCancelled  DeploymentStatus = "Deployment Cancelled"
 	DeploymentNotStarted DeploymentStatus = "Deployment Not Started"
 	DestroyInProgress    DeploymentStatus = "Destroy In Progress"
 	DestroyCompleted     DeploymentStatus = "Destroy Completed"
 	DestroyFailed        DeploymentStatus = "Destroy Failed"
+	DestroyCancelled     DeploymentStatus = "Destroy Cancelled"
+	ExtendInProgress     DeploymentStatus = "Extend In Progress"
+	ExtendCompleted      DeploymentStatus = "Extend Completed"
+	ExtendFailed         DeploymentStatus = "Extend Failed"
+	ExtendCancelled      DeploymentStatus = "Extend Cancelled"
+)
+
+type DriftStatus string
+
+const (
+	NoDrift          DriftStatus = "No Drift"
+	Drifted          DriftStatus = "Drifted"
+	DriftCheckFailed DriftStatus = "Drift Check Failed"
 )
 
 type Deployment struct {
@@ -31,10 +47,14 @@ type Deployment struct {
 	DeploymentSubscriptionId     string           `json:"deploymentSubscriptionId"`
 	DeploymentWorkspace          string           `json:"deploymentWorkspace"`
 	DeploymentStatus             DeploymentStatus `json:"deploymentStatus"`
+	DeploymentStatusReason       string           `json:"deploymentStatusReason"` // why last action failed, like a timeout.
 	DeploymentLab                LabType          `json:"deploymentLab"`
 	DeploymentAutoDelete         bool             `json:"deploymentAutoDelete"`
 	DeploymentLifespan           int64            `json:"deploymentLifespan"`
 	DeploymentAutoDeleteUnixTime int64            `json:"deploymentAutoDeleteUnixTime"`
+	DeploymentDriftStatus        DriftStatus      `json:"deploymentDriftStatus"`
+	DeploymentDriftedResources   []string         `json:"deploymentDriftedResources"` // addresses of resources plan would change.
+	DeploymentDriftCheckedAt     int64            `json:"deploymentDriftCheckedAt"`   // unix time, 0 if never checked.
 }
 
 type DeploymentEntry struct {
@@ -64,14 +84,28 @@ type DeploymentService interface {
 	UpsertDeployment(Deployment) error
 	DeleteDeployment(string, string, string) error
 	PollAndDeleteDeployments(time.Duration) error
+
+	// Periodically plans completed deployments and records drift on them.
+	PollAndDetectDrift(time.Duration) error
 	FetchDeploymentsToBeDeleted() []Deployment
 	ChangeTerraformWorkspace(Deployment) error
+
+	// Terraform outputs of the deployment's workspace.
+	GetDeploymentOutputs(workspace string, showSensitive bool) (map[string]TerraformOutput, error)
+
+	// Workspaces of the user, and deployments whose workspace is gone, with their details.
+	GetWorkspaceDetails(userId string) ([]WorkspaceDetails, error)
+
+	// Deletes orphaned workspaces without resources and deployments whose workspace is gone.
+	// Nothing is changed unless confirmed, actions that would be done are returned.
+	ReconcileOrphans(userId string, confirm bool) ([]ReconcileAction, error)
 }
 
 type DeploymentRepository interface {
 	GetDeployments() ([]Deployment, error)
-	GetMyDeployments(string, string) ([]Deployment, error)
-	GetDeployment(string, string, string) (Deployment, error)
+	// JSON of deployments as stored, labs in them may be of older schema version.
+	GetMyDeployments(string, string) (string, error)
+	GetDeployment(string, string, string) (string, error)
 	UpsertDeployment(Deployment) error
 	// DeploymentOperationEntry(Deployment) error
 	DeleteDeployment(string, string, string) error
@@ -1,5 +1,16 @@
 package entity
 
+import "errors"
+
+var ErrUnsupportedTfvarsFormat = errors.New("unsupported format, expected tfvars.json or hcl")
+var ErrInvalidTfvars = errors.New("invalid tfvars")
+
+// Formats lab template can be exported to.
+const (
+	TfvarsFormatJSON = "tfvars.json"
+	TfvarsFormatHCL  = "hcl"
+)
+
 // var SasToken string
 // var StorageAccountName string
 var ProtectedLabSecret string
@@ -84,6 +95,13 @@ type TfvarConfigType struct {
 	AppGateways           []AppGatewayType                `json:"appGateways"`
 }
 
+// Terraform variable of lab template. Name is the variable name in tf/ and
+// Value is JSON encoded, the same as passed to terraform in TF_VAR_<Name>.
+type TfvarVariable struct {
+	Name  string
+	Value string
+}
+
 type Blob struct {
 	Name string `xml:"Name" json:"name"`
 	//Url  string `xml:"Url" json:"url"`
@@ -99,7 +117,11 @@ type EnumerationResults struct {
 	Blobs Blobs `xml:"Blobs" json:"blobs"`
 }
 
+// Version of lab template this server writes. Older labs are migrated when loaded.
+const LabSchemaVersion = 2
+
 type LabType struct {
+	SchemaVersion            int             `json:"schemaVersion"`
 	Id                       string          `json:"id"`
 	Name                     string          `json:"name"`
 	Description              string          `json:"description"`
@@ -128,7 +150,33 @@ type BlobType struct {
 	VersionId string `json:"versionId"`
 }
 
+// Problem found in lab template. Path is of the field in lab, like 'template.subnets[0].addressPrefixes[1]'.
+type LabValidationIssue struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// Lab with errors would fail in terraform and must not be run. Warnings don't block the run.
+type LabValidationResult struct {
+	Valid    bool                 `json:"valid"`
+	Errors   []LabValidationIssue `json:"errors"`
+	Warnings []LabValidationIssue `json:"warnings"`
+}
+
 type LabService interface {
+	// Checks lab template for values terraform would fail on, without running terraform.
+	ValidateLab(LabType) LabValidationResult
+
+	// JSON Schema of LabType.
+	GetLabSchema() map[string]interface{}
+
+	// Template of lab in redis as terraform variables file of the format.
+	ExportLab(format string) (string, error)
+
+	// Lab with template read from terraform variables file of the format. Format is
+	// detected from the content if empty. Lab isn't validated or saved.
+	ImportLab(format string, data []byte) (LabType, error)
+
 	GetLabFromRedis() (LabType, error)
 	SetLabInRedis(LabType) error
 	DeleteLabFromRedis() error
@@ -1,19 +1,73 @@
 package entity
 
+import "context"
+
 type LogStream struct {
-	Logs string `json:"logs"`
+	OperationId string `json:"operationId"`
+	Logs        string `json:"logs"`
+}
+
+// A single append to the log stream of an operation.
+// Seq starts at 1 and increases by one with every append. A line with Seq 0
+// is sent when the log stream is cleared.
+type LogLine struct {
+	OperationId string `json:"operationId"`
+	Seq         int64  `json:"seq"`
+	Line        string `json:"line"`
 }
 
+// Logs are kept per operation. Methods without operation id work on the
+// log stream of the latest operation.
 type LogStreamService interface {
+	// Starts an empty log stream for the operation and makes it the latest.
+	StartLogStream(operationId string) error
+
+	// Starts an empty log stream for operation started by server, it doesn't become the latest.
+	StartBackgroundLogStream(operationId string) error
+
 	AppendLogs(logs string) error
 	SetLogs(logs string) error
 	GetLogs() (LogStream, error)
 	ClearLogs() error
-	WaitForLogsChange() (LogStream, error)
+
+	// Sends lines of the latest operation after the sequence number and then
+	// continues with new lines until context is done. If operation id is set and is
+	// not the latest operation anymore, all lines of latest operation are sent.
+	StreamLogs(ctx context.Context, operationId string, afterSeq int64, send func(LogLine) error) error
+
+	AppendOperationLogs(operationId string, logs string) error
+	GetOperationLogs(operationId string) (LogStream, error)
+
+	// Sends lines of the operation after the sequence number and then
+	// continues with new lines until context is done.
+	StreamOperationLogs(ctx context.Context, operationId string, afterSeq int64, send func(LogLine) error) error
 }
 
 type LogStreamRepository interface {
-	SetLogsInRedis(logStream string) error
-	GetLogsFromRedis() (string, error)
-	WaitForLogsChange() (string, error)
+	// Appends the line and returns its sequence number.
+	AppendLogLine(operationId string, line string) (int64, error)
+
+	// Lines starting at sequence number.
+	GetLogLines(operationId string, fromSeq int64) ([]string, error)
+	GetLogLinesCount(operationId string) (int64, error)
+	DeleteLogLines(operationId string) error
+
+	// Publishes the change to clients of the operation, and
+	// clients following the latest operation if it is the latest.
+	PublishLogLine(operationId string, val string) error
+
+	// Subscription is active when this returns, nothing published after is missed.
+	// Call the returned function to unsubscribe.
+	SubscribeToLogs(operationId string) (<-chan string, func(), error)
+
+	// Makes the operation the latest. Log streams of operations older than
+	// configured history limit are removed.
+	SetLatestOperationId(operationId string) error
+	GetLatestOperationId() (string, error)
+
+	// Log streams of background operations are kept in their own history.
+	AddBackgroundOperationId(operationId string) error
+
+	// Subscribes to logs of whichever operation is the latest.
+	SubscribeToLatestLogs() (<-chan string, func(), error)
 }
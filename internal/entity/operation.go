@@ -0,0 +1,87 @@
+package entity
+
+import "errors"
+
+// Returned by terraform service when the running operation was cancelled by user.
+var ErrOperationCancelled = errors.New("operation cancelled")
+
+// Returned by terraform service when the running operation didn't finish before its deadline.
+var ErrOperationTimedOut = errors.New("operation timed out")
+
+// Operation is the persisted record of a single terraform action or extend script run.
+// Operations are keyed by the operation id sent by the client on the route.
+type Operation struct {
+	OperationId string           `json:"operationId"`
+	Action      string           `json:"action"`
+	Mode        string           `json:"mode"` // only set for extend operations.
+	Workspace   string           `json:"workspace"`
+	LabId       string           `json:"labId"`
+	LabName     string           `json:"labName"`
+	UserId      string           `json:"userId"`
+	InProgress  bool             `json:"inProgress"`
+	StartTime   int64            `json:"startTime"` // unix time
+	EndTime     int64            `json:"endTime"`   // unix time, 0 while in progress
+	ExitCode    int              `json:"exitCode"`
+	Status      DeploymentStatus `json:"status"`
+	Error       string           `json:"error"`
+	PlanResult  *PlanResult      `json:"planResult,omitempty"` // only set for completed plan operations.
+
+	// Hash of lab template the operation ran with.
+	TemplateHash string `json:"templateHash,omitempty"`
+
+	// Plan operation whose saved plan is applied, only set for apply operations.
+	PlanId string `json:"planId,omitempty"`
+
+	// Resource addresses passed as -target, only set for targeted apply and destroy.
+	Targeted bool     `json:"targeted"`
+	Targets  []string `json:"targets,omitempty"`
+
+	// Attempts of terraform actions the operation ran, more than one if retried.
+	Attempts []OperationAttempt `json:"attempts,omitempty"`
+
+	// Operation started by server and not by user, like drift checks.
+	// Its logs don't replace the latest log stream.
+	Background bool `json:"background,omitempty"`
+}
+
+// One run of a terraform action as part of an operation.
+type OperationAttempt struct {
+	Action         string `json:"action"`
+	Attempt        int    `json:"attempt"` // starts at 1 for every action.
+	StartTime      int64  `json:"startTime"`
+	EndTime        int64  `json:"endTime"`
+	ExitCode       int    `json:"exitCode"`
+	Error          string `json:"error"`
+	TransientError string `json:"transientError"` // pattern found in output that made it retryable.
+	Retried        bool   `json:"retried"`
+}
+
+type OperationService interface {
+	// Latest operation first.
+	GetOperations() ([]Operation, error)
+	GetOperation(operationId string) (Operation, error)
+
+	// Records the start of the operation and returns the persisted record.
+	// An operation id is generated if not provided.
+	StartOperation(Operation) (Operation, error)
+
+	// Records the end of the operation with final status.
+	// Exit code is derived from the error returned by the action.
+	// Attempts recorded while operation was running are kept.
+	EndOperation(Operation, DeploymentStatus, error) (Operation, error)
+
+	// Adds attempt to the persisted operation.
+	RecordAttempt(operationId string, attempt OperationAttempt) error
+}
+
+type OperationRepository interface {
+	GetOperations() ([]string, error)
+	GetOperation(operationId string) (string, error)
+
+	// Adds a new operation to history. Older operations beyond the configured
+	// history limit are removed.
+	AddOperation(operationId string, val string) error
+
+	// Updates an existing operation.
+	SetOperation(operationId string, val string) error
+}
@@ -1,11 +1,100 @@
 package entity
 
+import "errors"
+
+var ErrBlobNotFound = errors.New("the specified blob does not exist")
+var ErrBlobLeased = errors.New("the blob is leased, terraform may be working on it")
+
+// Container of terraform state files in storage account.
+const TfStateContainerName = "repro-project-tf-state-files"
+
+// Lease on terraform state blob of a workspace. Terraform leases the blob while it holds the state lock.
+type BlobLease struct {
+	WorkspaceName string `json:"workspaceName"`
+	BlobName      string `json:"blobName"`
+	Leased        bool   `json:"leased"`
+	LeaseState    string `json:"leaseState"`
+	LeaseStatus   string `json:"leaseStatus"`
+	LeaseDuration string `json:"leaseDuration"`
+	LastModified  int64  `json:"lastModified"`
+	Size          int64  `json:"size"` // of the state blob, in bytes.
+
+	// Lock info terraform keeps in blob metadata while it holds the lock.
+	LockId        string `json:"lockId"`
+	LockOperation string `json:"lockOperation"`
+	LockWho       string `json:"lockWho"`
+	LockCreated   int64  `json:"lockCreated"` // 0 if unknown.
+
+	// Set if an operation of this server holds the action lock on the workspace.
+	HeldByServer      bool   `json:"heldByServer"`
+	ServerOperationId string `json:"serverOperationId"`
+}
+
+// Audit entry for lease broken on state blob of a workspace.
+type LeaseBreakAudit struct {
+	Id              string `json:"id"`
+	WorkspaceName   string `json:"workspaceName"`
+	BlobName        string `json:"blobName"`
+	LockId          string `json:"lockId"`
+	LockWho         string `json:"lockWho"`
+	LeaseAgeSeconds int64  `json:"leaseAgeSeconds"`
+	OperationId     string `json:"operationId"` // operation that found the stale lock, empty if broken by user.
+	Automatic       bool   `json:"automatic"`
+	BrokenAt        int64  `json:"brokenAt"`
+}
+
+// Snapshot of terraform state blob of a workspace.
+type StateSnapshot struct {
+	WorkspaceName string `json:"workspaceName"`
+	SnapshotId    string `json:"snapshotId"` // time of snapshot as given by storage account.
+	CreatedAt     int64  `json:"createdAt"`
+	Size          int64  `json:"size"`
+	Action        string `json:"action"`      // action that the snapshot was taken before.
+	OperationId   string `json:"operationId"` // operation that the snapshot was taken for.
+}
+
 type StorageAccountService interface {
 	GetStorageAccountName() (string, error)
 	BreakBlobLease(storageAccountName string, containerName string, workspaceName string) error
+
+	// Lease on state blob of the workspace.
+	GetBlobLease(storageAccountName string, containerName string, workspaceName string) (BlobLease, error)
+
+	// Number of resource instances in state blob of the workspace, same as lines of 'terraform state list'.
+	// Read from the blob, so terraform isn't run. Fails with ErrBlobNotFound if workspace has no state yet.
+	GetStateResourceCount(storageAccountName string, containerName string, workspaceName string) (int, error)
+
+	AddLeaseBreakAudit(LeaseBreakAudit) error
+	GetLeaseBreakAudits() ([]LeaseBreakAudit, error)
+
+	// Snapshots state blob of the workspace. Workspace without state yet has nothing to snapshot,
+	// empty snapshot is returned.
+	CreateStateSnapshot(storageAccountName string, containerName string, workspaceName string, action string, operationId string) (StateSnapshot, error)
+
+	// Latest snapshot comes first.
+	ListStateSnapshots(storageAccountName string, containerName string, workspaceName string) ([]StateSnapshot, error)
+
+	// Replaces state of the workspace with the snapshot. Current state is snapshotted first.
+	// Fails with ErrBlobLeased if terraform holds lock on the state.
+	RestoreStateSnapshot(storageAccountName string, containerName string, workspaceName string, snapshotId string) error
 }
 
 type StorageAccountRepository interface {
 	GetStorageAccountName() (string, error)
 	BreakBlobLease(storageAccountName string, containerName string, blobName string) error
+	GetBlobLease(storageAccountName string, containerName string, blobName string) (BlobLease, error)
+
+	// Content of the blob.
+	GetBlob(storageAccountName string, containerName string, blobName string) (string, error)
+
+	// Latest audit entries come first.
+	AddLeaseBreakAudit(val string) error
+	GetLeaseBreakAudits() ([]string, error)
+
+	// Action and operation are saved in metadata of the snapshot. Returns snapshot id.
+	CreateBlobSnapshot(storageAccountName string, containerName string, blobName string, action string, operationId string) (string, error)
+	ListBlobSnapshots(storageAccountName string, containerName string, blobName string) ([]StateSnapshot, error)
+
+	// Copies the snapshot over the blob and waits for copy to finish.
+	RestoreBlobSnapshot(storageAccountName string, containerName string, blobName string, snapshotId string) error
 }
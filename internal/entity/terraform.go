@@ -5,16 +5,37 @@ import (
 	"os/exec"
 )
 
+// Resource that a plan changes.
+type PlanResourceChange struct {
+	Address string `json:"address"`
+	Type    string `json:"type"`
+}
+
+// Summary of what applying a plan would do, parsed from 'terraform show -json'.
+type PlanResult struct {
+	Create       []PlanResourceChange `json:"create"`
+	Update       []PlanResourceChange `json:"update"`
+	Replace      []PlanResourceChange `json:"replace"`
+	Delete       []PlanResourceChange `json:"delete"`
+	TotalCreate  int                  `json:"totalCreate"`
+	TotalUpdate  int                  `json:"totalUpdate"`
+	TotalReplace int                  `json:"totalReplace"`
+	TotalDelete  int                  `json:"totalDelete"`
+}
+
 type TerraformService interface {
 	// Terraform Init
-	Init() error
+	Init(Operation) error
 
-	// Streams logs
-	Plan(LabType) error
+	// Streams logs. Plan is saved to a file named after the operation
+	// and summary of changes is returned.
+	Plan(Operation, LabType) (PlanResult, error)
 
 	// Apply terraform and then run extend script if any
-	// This streams logs.
-	Apply(LabType) error
+	// This streams logs. If operation has plan id, the saved plan of
+	// that plan operation is applied instead of planning again.
+	// Targeted operation only applies its targets and doesn't run extend script.
+	Apply(Operation, LabType) error
 
 	// Apply terraform and then run extend script if any
 	// This is async and doesn't stream logs.
@@ -23,15 +44,18 @@ type TerraformService interface {
 	// Executes shell script to run extension of infra.
 	// runs against selected workspace. This doesn't send any response body
 	// and logs are streamed.
-	Extend(LabType, string) error
+	Extend(Operation, LabType, string) error
 
 	// Executes shell script to run extension of infra.
 	// runs against selected workspace. This is async and doesn't stream logs.
 	// ExtendAsync(LabType, string) (TerraformOperation, error)
 
 	// destroy the resources in current workspace.
-	// Streams logs
-	Destroy(LabType) error
+	// Streams logs. Targeted operation only destroys its targets and doesn't run extend script.
+	Destroy(Operation, LabType) error
+
+	// Each target must be an address in workspace's state or a module containing one.
+	ValidateTargets(workspace string, targets []string) error
 
 	// destroy the resources in current workspace.
 	// This is async and doesn't stream logs.
@@ -42,13 +66,27 @@ type TerraformService interface {
 	// and logs are streamed.
 	// Validate(LabType) error
 
+	// Plans against the workspace of operation without saving the plan for apply.
+	// Returns true if there are changes, i.e. infrastructure drifted from lab.
+	CheckDrift(Operation, LabType) (PlanResult, bool, error)
+
+	// Interrupts the running process of the operation. The action that is
+	// running the operation returns ErrOperationCancelled.
+	Cancel(operationId string) error
+
 	UpdateAssignment(userId string, labId string, status string) error
 	UpdateChallenge(userId string, labId string, status string) error
 }
 
 type TerraformRepository interface {
-	TerraformAction(TfvarConfigType, string, string) (*exec.Cmd, *os.File, *os.File, error)
-	ExecuteScript(script string, mode string, storageAccountName string) (*exec.Cmd, *os.File, *os.File, error)
+	// Commands run against the workspace in its own terraform data directory.
+	// Additional args are passed to terraform command of the action.
+	TerraformAction(tfvar TfvarConfigType, action string, storageAccountName string, workspace string, args ...string) (*exec.Cmd, *os.File, *os.File, error)
+
+	// Output of 'terraform show -json' for the saved plan file.
+	ShowPlan(planFile string, workspace string) ([]byte, error)
+
+	ExecuteScript(script string, mode string, storageAccountName string, workspace string) (*exec.Cmd, *os.File, *os.File, error)
 
 	UpdateAssignment(userId string, labId string, status string) error
 	UpdateChallenge(userId string, labId string, status string) error
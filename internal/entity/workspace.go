@@ -1,5 +1,9 @@
 package entity
 
+import "errors"
+
+var ErrInvalidWorkspaceName = errors.New("workspace name can only have letters, digits, '_' and '-'")
+
 // Terraform workspace.
 // Terraform workspace has a name and its selected or not.
 // There is always a 'default' workspace and is selected by default.
@@ -8,6 +12,47 @@ type Workspace struct {
 	Selected bool   `json:"selected"`
 }
 
+// Workspace with what is known about it, workspace is orphaned if it has no deployment,
+// or deployment's workspace doesn't exist anymore.
+type WorkspaceDetails struct {
+	Workspace
+	Exists            bool        `json:"exists"`            // false if only the deployment of the workspace exists.
+	ResourceCount     int         `json:"resourceCount"`     // -1 if state couldn't be read.
+	StateSize         int64       `json:"stateSize"`         // 0 if there is no state yet.
+	StateLastModified int64       `json:"stateLastModified"` // unix time, 0 if there is no state yet.
+	Deployment        *Deployment `json:"deployment"`
+	Orphaned          bool        `json:"orphaned"`
+}
+
+// What reconcile does, or would do without confirmation, to an orphaned workspace.
+type ReconcileAction struct {
+	Workspace string `json:"workspace"`
+	Action    string `json:"action"` // "delete-workspace", "delete-deployment" or "skip".
+	Reason    string `json:"reason"`
+	Done      bool   `json:"done"`
+	Error     string `json:"error"`
+}
+
+// Output of 'terraform output -json'.
+// Value of sensitive output is 'redacted' unless explicitly requested.
+type TerraformOutput struct {
+	Sensitive bool        `json:"sensitive"`
+	Type      interface{} `json:"type"`
+	Value     interface{} `json:"value"`
+}
+
+// Managed resource in terraform state, from 'terraform show -json'.
+type TerraformResource struct {
+	Address    string                 `json:"address"`
+	Type       string                 `json:"type"`
+	Name       string                 `json:"name"`
+	Module     string                 `json:"module"` // empty for resources in root module.
+	ResourceId string                 `json:"resourceId"`
+	Location   string                 `json:"location"`
+	PortalUrl  string                 `json:"portalUrl"` // empty if resource is not an azure resource.
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
 type WorkspaceService interface {
 	List() ([]Workspace, error)
 	GetSelectedWorkspace() (Workspace, error)
@@ -17,8 +62,14 @@ type WorkspaceService interface {
 	Select(Workspace) error
 	Delete(Workspace) error
 
-	// Resources of selected workspace
-	Resources() (string, error)
+	// Resources of selected workspace, only of given types if any.
+	Resources(resourceTypes []string) ([]TerraformResource, error)
+
+	// Terraform outputs of the workspace by name.
+	Outputs(workspace string, showSensitive bool) (map[string]TerraformOutput, error)
+
+	// Addresses of resources in state of the workspace. Not cached.
+	StateList(workspace string) ([]string, error)
 
 	// Invalidate Cache
 	DeleteAllWorkspaceFromRedis() error
@@ -49,9 +100,10 @@ type WorkspaceRepository interface {
 	Delete(Workspace) error
 
 	// Gets the resources in current selected workspace.
-	// The Resources are just a string and thus returned as is.
+	// Output of 'terraform show -json' is returned as is.
 	Resources(StorageAccount string) (string, error)
 
+	// Cached resources are JSON of []TerraformResource, never raw state.
 	GetResourcesFromRedis() (string, error)
 	AddResourcesToRedis(val string)
 
@@ -59,4 +111,16 @@ type WorkspaceRepository interface {
 	// All mutating terraform operations must delete resources
 	// from redis to ensure fresh data.
 	DeleteResourcesFromRedis()
+
+	// Output of 'terraform output -json' for the workspace.
+	Outputs(workspace string) (string, error)
+
+	// Output of 'terraform state list' for the workspace.
+	StateList(workspace string) (string, error)
+
+	// Outputs are cached per workspace, as JSON of map[string]TerraformOutput with sensitive
+	// values redacted. All mutating terraform operations must delete outputs from redis as well.
+	GetOutputsFromRedis(workspace string) (string, error)
+	AddOutputsToRedis(workspace string, val string)
+	DeleteOutputsFromRedis()
 }
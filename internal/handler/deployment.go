@@ -1,14 +1,18 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"one-click-aks-server/internal/entity"
 	"one-click-aks-server/internal/helper"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
 	"golang.org/x/exp/slog"
 )
 
@@ -16,48 +20,59 @@ type deploymentHandler struct {
 	deploymentService   entity.DeploymentService
 	terraformService    entity.TerraformService
 	actionStatusService entity.ActionStatusService
+	operationService    entity.OperationService
+	labBinding          binding.Binding
 }
 
 func NewDeploymentHandler(r *gin.RouterGroup,
 	service entity.DeploymentService,
 	terraformService entity.TerraformService,
-	actionStatusService entity.ActionStatusService) {
+	actionStatusService entity.ActionStatusService,
+	strictLabBinding bool) {
 	handler := &deploymentHandler{
 		deploymentService:   service,
 		terraformService:    terraformService,
 		actionStatusService: actionStatusService,
+		labBinding:          helperLabBinding(strictLabBinding),
 	}
 
 	//r.GET("/deployments", handler.GetDeployments)
 	r.GET("/deployments/my", handler.GetMyDeployments)
 	r.GET("/deployments/:workspace", handler.GetDeployment)
+	r.GET("/deployments/:workspace/outputs", handler.GetDeploymentOutputs)
 
 	// use this for operations to update in place when action is in progress
 	// like update auto destroy and destroy time
 	r.PATCH("/deployments", handler.UpsertDeployment)
+
+	// not allowed while action is in progress on the deployment's workspace.
+	r.PUT("/deployments", handler.UpsertDeploymentWithActionLock)
+	r.POST("/deployments", handler.UpsertDeploymentWithActionLock)
 }
 
 func NewDeploymentWithActionStatusHandler(r *gin.RouterGroup, service entity.DeploymentService,
 	terraformService entity.TerraformService,
-	actionStatusService entity.ActionStatusService) {
+	actionStatusService entity.ActionStatusService,
+	strictLabBinding bool) {
 	handler := &deploymentHandler{
 		deploymentService:   service,
 		terraformService:    terraformService,
 		actionStatusService: actionStatusService,
+		labBinding:          helperLabBinding(strictLabBinding),
 	}
 
-	r.PUT("/deployments", handler.UpsertDeployment)
-	r.POST("/deployments", handler.UpsertDeployment)
 	r.PUT("/deployments/select", handler.SelectDeployment)
 }
 
 func NewDeploymentWithTerraformActionStatusHandler(r *gin.RouterGroup, service entity.DeploymentService,
 	terraformService entity.TerraformService,
-	actionStatusService entity.ActionStatusService) {
+	actionStatusService entity.ActionStatusService,
+	operationService entity.OperationService) {
 	handler := &deploymentHandler{
 		deploymentService:   service,
 		terraformService:    terraformService,
 		actionStatusService: actionStatusService,
+		operationService:    operationService,
 	}
 
 	r.DELETE("/deployments/:workspace/:subscriptionId/:operationId", handler.DeleteDeployment)
@@ -91,13 +106,42 @@ func (d *deploymentHandler) GetDeployment(c *gin.Context) {
 	c.IndentedJSON(http.StatusOK, deployment)
 }
 
+// Sensitive outputs are redacted unless showSensitive=true is passed.
+func (d *deploymentHandler) GetDeploymentOutputs(c *gin.Context) {
+	workspace := c.Param("workspace")
+	if !helperValidateWorkspace(c, workspace) {
+		return
+	}
+
+	showSensitive := false
+	if val := c.Query("showSensitive"); val != "" {
+		var err error
+		if showSensitive, err = strconv.ParseBool(val); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "showSensitive must be true or false"})
+			return
+		}
+	}
+
+	outputs, err := d.deploymentService.GetDeploymentOutputs(workspace, showSensitive)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, outputs)
+}
+
 func (d *deploymentHandler) SelectDeployment(c *gin.Context) {
 	deployment := entity.Deployment{}
-	if err := c.Bind(&deployment); err != nil {
+	if err := c.ShouldBindWith(&deployment, d.labBinding); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	if !helperValidateWorkspace(c, deployment.DeploymentWorkspace) {
+		return
+	}
+
 	if err := d.deploymentService.SelectDeployment(deployment); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -108,11 +152,38 @@ func (d *deploymentHandler) SelectDeployment(c *gin.Context) {
 
 func (d *deploymentHandler) UpsertDeployment(c *gin.Context) {
 	deployment := entity.Deployment{}
-	if err := c.Bind(&deployment); err != nil {
+	if err := c.ShouldBindWith(&deployment, d.labBinding); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !helperValidateWorkspace(c, deployment.DeploymentWorkspace) {
+		return
+	}
+
+	d.helperUpsertDeployment(c, deployment)
+}
+
+func (d *deploymentHandler) UpsertDeploymentWithActionLock(c *gin.Context) {
+	deployment := entity.Deployment{}
+	if err := c.ShouldBindWith(&deployment, d.labBinding); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	if !helperValidateWorkspace(c, deployment.DeploymentWorkspace) {
+		return
+	}
+
+	if !helperAcquireActionLock(c, d.actionStatusService, deployment.DeploymentWorkspace) {
+		return
+	}
+	defer d.actionStatusService.ReleaseActionLock(deployment.DeploymentWorkspace)
+
+	d.helperUpsertDeployment(c, deployment)
+}
+
+func (d *deploymentHandler) helperUpsertDeployment(c *gin.Context, deployment entity.Deployment) {
 	// Get auth token from authorization header to get userPrincipal
 	authToken := c.GetHeader("Authorization")
 	authToken = strings.Split(authToken, "Bearer ")[1]
@@ -135,6 +206,9 @@ func (d *deploymentHandler) UpsertDeployment(c *gin.Context) {
 func (d *deploymentHandler) DeleteDeployment(c *gin.Context) {
 	workspace := c.Param("workspace")
 	subscriptionId := c.Param("subscriptionId")
+	if !helperValidateWorkspace(c, workspace) {
+		return
+	}
 
 	// Get auth token from authorization header to get userPrincipal
 	authToken := c.GetHeader("Authorization")
@@ -147,6 +221,10 @@ func (d *deploymentHandler) DeleteDeployment(c *gin.Context) {
 		return
 	}
 
+	if !helperAcquireActionLock(c, d.actionStatusService, workspace) {
+		return
+	}
+
 	terraformOperation := entity.TerraformOperation{
 		OperationId: c.Param("operationId"),
 		InProgress:  true,
@@ -161,13 +239,25 @@ func (d *deploymentHandler) DeleteDeployment(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 	}
 
+	operation, err := d.operationService.StartOperation(entity.Operation{
+		OperationId: terraformOperation.OperationId,
+		Action:      "destroy",
+		Workspace:   workspace,
+		LabId:       deployment.DeploymentLab.Id,
+		LabName:     deployment.DeploymentLab.Name,
+		UserId:      userPrincipal,
+		Status:      entity.DestroyInProgress,
+	})
+	if err != nil {
+		slog.Error("error starting operation ", err)
+	}
+
 	// Start the long-running operation in a goroutine
 	go func() {
-		if err := d.actionStatusService.SetActionStart(); err != nil {
-			slog.Error("error setting action start ", err)
-		}
-
-		if err := d.terraformService.Destroy(deployment.DeploymentLab); err != nil {
+		err := d.terraformService.Destroy(operation, deployment.DeploymentLab)
+		if errors.Is(err, entity.ErrOperationCancelled) {
+			terraformOperation.Status = entity.DestroyCancelled
+		} else if err != nil {
 			terraformOperation.Status = entity.DestroyFailed
 		} else {
 			terraformOperation.Status = entity.DestroyCompleted
@@ -178,13 +268,42 @@ func (d *deploymentHandler) DeleteDeployment(c *gin.Context) {
 			slog.Error("error setting terraform operation ", err)
 		}
 
-		// Delete the deployment
-		if err := d.deploymentService.DeleteDeployment(userPrincipal, workspace, subscriptionId); err != nil {
-			slog.Error("error deleting deployment ", err)
+		if _, err := d.operationService.EndOperation(operation, terraformOperation.Status, err); err != nil {
+			slog.Error("error ending operation ", err)
+		}
+
+		// Destroy that didn't complete, cancelled, timed out or failed, leaves resources behind, keep the deployment.
+		if err != nil {
+			notification := entity.ServerNotification{
+				Id:               uuid.New().String(),
+				NotificationType: entity.Warning,
+				Message:          string(entity.DestroyCancelled),
+				AutoClose:        5000,
+			}
+
+			deployment.DeploymentStatus = terraformOperation.Status
+			deployment.DeploymentStatusReason = ""
+			if terraformOperation.Status == entity.DestroyFailed {
+				deployment.DeploymentStatusReason = err.Error()
+				notification.NotificationType = entity.Error
+				notification.Message = string(entity.DestroyFailed) + ". " + err.Error()
+			}
+			if err := d.deploymentService.UpsertDeployment(deployment); err != nil {
+				slog.Error("error updating deployment ", err)
+			}
+
+			if err := d.actionStatusService.SetServerNotification(notification); err != nil {
+				slog.Error("error setting server notification ", err)
+			}
+		} else {
+			// Delete the deployment
+			if err := d.deploymentService.DeleteDeployment(userPrincipal, workspace, subscriptionId); err != nil {
+				slog.Error("error deleting deployment ", err)
+			}
 		}
 
-		if err := d.actionStatusService.SetActionEnd(); err != nil {
-			slog.Error("error setting action end ", err)
+		if err := d.actionStatusService.ReleaseActionLock(workspace); err != nil {
+			slog.Error("error releasing action lock ", err)
 		}
 
 	}()
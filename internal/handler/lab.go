@@ -1,22 +1,67 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"strings"
 
 	"one-click-aks-server/internal/entity"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
+// Binding of request bodies carrying a lab. In strict mode, they are rejected if they have
+// fields lab doesn't know. Otherwise unknown fields are dropped.
+func helperLabBinding(strict bool) binding.Binding {
+	if strict {
+		return strictJSONBinding{}
+	}
+	return binding.JSON
+}
+
+// Same as binding.JSON but fails on unknown fields.
+type strictJSONBinding struct{}
+
+func (strictJSONBinding) Name() string {
+	return "json"
+}
+
+func (strictJSONBinding) Bind(req *http.Request, obj interface{}) error {
+	if req == nil || req.Body == nil {
+		return errors.New("invalid request")
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(obj); err != nil {
+		return err
+	}
+
+	if binding.Validator == nil {
+		return nil
+	}
+	return binding.Validator.ValidateStruct(obj)
+}
+
 type labHandler struct {
 	labService entity.LabService
+	labBinding binding.Binding
 }
 
-func NewLabHandler(r *gin.RouterGroup, labService entity.LabService) {
+func NewLabHandler(r *gin.RouterGroup, labService entity.LabService, strictLabBinding bool) {
 	handler := &labHandler{
 		labService: labService,
+		labBinding: helperLabBinding(strictLabBinding),
 	}
 	r.GET("/lab", handler.GetLabFromRedis)
+	r.GET("/lab/schema", handler.GetLabSchema)
+	r.GET("/lab/export", handler.ExportLab)
+	r.POST("/lab/import", handler.ImportLab)
 	r.PUT("/lab", handler.SetLabInRedis)
 	r.DELETE("/lab/redis", handler.DeleteLabFromRedis)
 	// r.POST("/lab", handler.AddMyLab)
@@ -37,17 +82,130 @@ func (l *labHandler) GetLabFromRedis(c *gin.Context) {
 func (l *labHandler) SetLabInRedis(c *gin.Context) {
 	lab := entity.LabType{}
 
-	if err := c.Bind(&lab); err != nil {
+	if err := c.ShouldBindWith(&lab, l.labBinding); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	validation := l.labService.ValidateLab(lab)
+	if !validation.Valid {
+		helperLabValidationError(c, validation)
+		return
+	}
+
 	if err := l.labService.SetLabInRedis(lab); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.Status(http.StatusOK)
+	// warnings don't stop the lab from being saved.
+	c.IndentedJSON(http.StatusOK, validation)
+}
+
+func (l *labHandler) GetLabSchema(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, l.labService.GetLabSchema())
+}
+
+// Template of current lab as terraform variables, to be run with plain terraform against tf/.
+func (l *labHandler) ExportLab(c *gin.Context) {
+	format := c.DefaultQuery("format", entity.TfvarsFormatJSON)
+
+	tfvars, err := l.labService.ExportLab(format)
+	if errors.Is(err, entity.ErrUnsupportedTfvarsFormat) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	fileName := "lab.tfvars"
+	contentType := "text/plain; charset=utf-8"
+	if format == entity.TfvarsFormatJSON {
+		fileName = "lab.tfvars.json"
+		contentType = "application/json; charset=utf-8"
+	}
+
+	c.Header("Content-Disposition", "attachment; filename="+fileName)
+	c.Data(http.StatusOK, contentType, []byte(tfvars))
+}
+
+// Reads lab from tfvars file sent as body or as multipart 'file'. Format is taken from
+// query, then file extension, and is detected from content otherwise.
+// Lab is saved as current lab if 'save' is true.
+func (l *labHandler) ImportLab(c *gin.Context) {
+	save, err := helperBoolQuery(c, "save")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	format := c.Query("format")
+
+	var data []byte
+	if file, fileErr := c.FormFile("file"); fileErr == nil {
+		if format == "" && strings.HasSuffix(file.Filename, ".json") {
+			format = entity.TfvarsFormatJSON
+		}
+		var opened multipart.File
+		if opened, err = file.Open(); err == nil {
+			data, err = io.ReadAll(opened)
+			opened.Close()
+		}
+	} else {
+		data, err = io.ReadAll(c.Request.Body)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	lab, err := l.labService.ImportLab(format, data)
+	if errors.Is(err, entity.ErrUnsupportedTfvarsFormat) || errors.Is(err, entity.ErrInvalidTfvars) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	validation := l.labService.ValidateLab(lab)
+	if !validation.Valid {
+		helperLabValidationError(c, validation)
+		return
+	}
+
+	if save {
+		if err := l.labService.SetLabInRedis(lab); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"lab":        lab,
+		"validation": validation,
+	})
+}
+
+// Responds with errors and warnings if lab is not valid. Returns true if lab is valid.
+func helperValidateLab(c *gin.Context, labService entity.LabService, lab entity.LabType) bool {
+	validation := labService.ValidateLab(lab)
+	if !validation.Valid {
+		helperLabValidationError(c, validation)
+		return false
+	}
+	return true
+}
+
+func helperLabValidationError(c *gin.Context, validation entity.LabValidationResult) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":    fmt.Sprintf("lab template has %d errors", len(validation.Errors)),
+		"errors":   validation.Errors,
+		"warnings": validation.Warnings,
+	})
 }
 
 func (l *labHandler) DeleteLabFromRedis(c *gin.Context) {
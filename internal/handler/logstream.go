@@ -1,7 +1,10 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strconv"
 
 	"one-click-aks-server/internal/entity"
 
@@ -26,6 +29,10 @@ func NewLogStreamHandler(r *gin.Engine, service entity.LogStreamService) {
 	r.GET("/logsws", func(c *gin.Context) {
 		handler.GetLogsWs(c.Writer, c.Request)
 	})
+	r.GET("/logs/:operationId", handler.GetOperationLogs)
+	r.GET("/logsws/:operationId", func(c *gin.Context) {
+		handler.GetOperationLogsWs(c.Writer, c.Request, c.Param("operationId"))
+	})
 }
 
 func (l *logStreamHandler) GetLogs(c *gin.Context) {
@@ -38,6 +45,16 @@ func (l *logStreamHandler) GetLogs(c *gin.Context) {
 	c.IndentedJSON(http.StatusOK, logStream)
 }
 
+func (l *logStreamHandler) GetOperationLogs(c *gin.Context) {
+	logStream, err := l.logStreamService.GetOperationLogs(c.Param("operationId"))
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, logStream)
+}
+
 func (l *logStreamHandler) AppendLogs(c *gin.Context) {
 	var logs string
 	if err := c.Bind(&logs); err != nil {
@@ -81,7 +98,15 @@ var logStreamUpgrader = websocket.Upgrader{
 	},
 }
 
+// Sends lines of the latest operation's logs as they are appended.
+// Client can resume by passing the operationId and seq of the last line it got.
 func (l *logStreamHandler) GetLogsWs(w http.ResponseWriter, r *http.Request) {
+	afterSeq, err := helperLogStreamSeq(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	ws, err := logStreamUpgrader.Upgrade(w, r, nil)
 	if err != nil {
 		slog.Error("failed to upgrade log stream web socket connection", err)
@@ -89,31 +114,63 @@ func (l *logStreamHandler) GetLogsWs(w http.ResponseWriter, r *http.Request) {
 	}
 	defer ws.Close()
 
-	// Get initial logs
-	initialLogs, err := l.logStreamService.GetLogs()
+	ctx := helperWebSocketContext(ws)
+	if err := l.logStreamService.StreamLogs(ctx, r.URL.Query().Get("operationId"), afterSeq, func(logLine entity.LogLine) error {
+		return ws.WriteJSON(logLine)
+	}); err != nil {
+		slog.Error("failed to stream logs to websocket", err)
+	}
+}
+
+// Sends lines of the operation's logs as they are appended.
+// Client can resume by passing seq of the last line it got.
+func (l *logStreamHandler) GetOperationLogsWs(w http.ResponseWriter, r *http.Request, operationId string) {
+	afterSeq, err := helperLogStreamSeq(r)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		slog.Error("failed to retrieve initial logs", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Send initial logs
-	if err := ws.WriteJSON(initialLogs); err != nil {
-		slog.Error("failed to write initial logs to websocket", err)
+	ws, err := logStreamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Error("failed to upgrade log stream web socket connection", err)
 		return
 	}
+	defer ws.Close()
 
-	for {
-		logStream, err := l.logStreamService.WaitForLogsChange()
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			slog.Error("failed to wait for logs change", err)
-			return
-		}
+	ctx := helperWebSocketContext(ws)
+	if err := l.logStreamService.StreamOperationLogs(ctx, operationId, afterSeq, func(logLine entity.LogLine) error {
+		return ws.WriteJSON(logLine)
+	}); err != nil {
+		slog.Error("failed to stream logs of operation to websocket", err)
+	}
+}
 
-		if err := ws.WriteJSON(logStream); err != nil {
-			slog.Error("failed to write logs to websocket", err)
-			return
-		}
+// Sequence number of the last line client has, 0 if it has none.
+func helperLogStreamSeq(r *http.Request) (int64, error) {
+	seq := r.URL.Query().Get("seq")
+	if seq == "" {
+		return 0, nil
+	}
+
+	afterSeq, err := strconv.ParseInt(seq, 10, 64)
+	if err != nil || afterSeq < 0 {
+		return 0, errors.New("seq must be a non-negative integer")
 	}
+
+	return afterSeq, nil
+}
+
+// Context is done when client closes the connection.
+func helperWebSocketContext(ws *websocket.Conn) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	return ctx
 }
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"net/http"
+
+	"one-click-aks-server/internal/entity"
+
+	"github.com/gin-gonic/gin"
+)
+
+type operationHandler struct {
+	operationService entity.OperationService
+}
+
+func NewOperationHandler(r *gin.RouterGroup, service entity.OperationService) {
+	handler := &operationHandler{
+		operationService: service,
+	}
+
+	r.GET("/operations", handler.GetOperations)
+	r.GET("/operations/:operationId", handler.GetOperation)
+}
+
+func (o *operationHandler) GetOperations(c *gin.Context) {
+	operations, err := o.operationService.GetOperations()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, operations)
+}
+
+func (o *operationHandler) GetOperation(c *gin.Context) {
+	operation, err := o.operationService.GetOperation(c.Param("operationId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "operation not found"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, operation)
+}
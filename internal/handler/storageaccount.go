@@ -1,33 +1,44 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 
 	"one-click-aks-server/internal/entity"
+	"one-click-aks-server/internal/helper"
 
 	"github.com/gin-gonic/gin"
+	"golang.org/x/exp/slog"
 )
 
 type StorageAccountHandler struct {
 	storageAccountService entity.StorageAccountService
+	actionStatusService   entity.ActionStatusService
+	workspaceService      entity.WorkspaceService
 }
 
-// func NewStorageAccountHandler(r *gin.RouterGroup, service entity.StorageAccountService) {
-// 	handler := &StorageAccountHandler{
-// 		storageAccountService: service,
-// 	}
+func NewStorageAccountHandler(r *gin.RouterGroup, service entity.StorageAccountService, actionStatusService entity.ActionStatusService) {
+	handler := &StorageAccountHandler{
+		storageAccountService: service,
+		actionStatusService:   actionStatusService,
+	}
 
-// 	//r.GET("/storageaccount", handler.GetStorageAccountConfiguration)
-// 	// r.GET("/storageaccount", handler.GetStorageAccount)
-// }
+	//r.GET("/storageaccount", handler.GetStorageAccountConfiguration)
+	// r.GET("/storageaccount", handler.GetStorageAccount)
+	r.GET("/storageaccount/lease/:workspaceName", handler.GetBlobLease)
+	r.GET("/storageaccount/leasebreakaudits", handler.GetLeaseBreakAudits)
+	r.GET("/storageaccount/statesnapshots/:workspaceName", handler.ListStateSnapshots)
+}
 
-func NewStorageAccountWithActionStatusHandler(r *gin.RouterGroup, service entity.StorageAccountService) {
+func NewStorageAccountWithActionStatusHandler(r *gin.RouterGroup, service entity.StorageAccountService, workspaceService entity.WorkspaceService) {
 	handler := &StorageAccountHandler{
 		storageAccountService: service,
+		workspaceService:      workspaceService,
 	}
 
 	//r.POST("/storageaccount", handler.ConfigureStorageAccount)
 	r.PUT("/storageaccount/breakbloblease/:workspaceName", handler.BreakBlobLease)
+	r.POST("/storageaccount/statesnapshots/:workspaceName/:snapshotId/restore", handler.RestoreStateSnapshot)
 }
 
 // func (s *StorageAccountHandler) GetStorageAccount(c *gin.Context) {
@@ -53,11 +64,127 @@ func (s *StorageAccountHandler) BreakBlobLease(c *gin.Context) {
 		return
 	}
 
-	err = s.storageAccountService.BreakBlobLease(storageAccountName, "repro-project-tf-state-files", workspaceName)
+	// lock info is gone once lease is broken, it's looked up for audit.
+	blobLease, err := s.storageAccountService.GetBlobLease(storageAccountName, entity.TfStateContainerName, workspaceName)
+	if err != nil {
+		slog.Debug("not able to get blob lease before breaking it", slog.String("error", err.Error()))
+	}
+
+	err = s.storageAccountService.BreakBlobLease(storageAccountName, entity.TfStateContainerName, workspaceName)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	if err := s.storageAccountService.AddLeaseBreakAudit(entity.LeaseBreakAudit{
+		WorkspaceName:   workspaceName,
+		BlobName:        blobLease.BlobName,
+		LockId:          blobLease.LockId,
+		LockWho:         blobLease.LockWho,
+		LeaseAgeSeconds: int64(helper.LeaseAge(blobLease).Seconds()),
+	}); err != nil {
+		slog.Error("not able to add lease break audit", err)
+	}
+
 	c.IndentedJSON(http.StatusOK, gin.H{"status": "success"})
 }
+
+func (s *StorageAccountHandler) GetBlobLease(c *gin.Context) {
+	workspaceName := c.Param("workspaceName")
+	if workspaceName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "workspaceName is required"})
+		return
+	}
+
+	storageAccountName, err := s.storageAccountService.GetStorageAccountName()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	blobLease, err := s.storageAccountService.GetBlobLease(storageAccountName, entity.TfStateContainerName, workspaceName)
+	if err != nil {
+		if errors.Is(err, entity.ErrBlobNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	operationId, held, err := s.actionStatusService.GetActionLockOperationId(workspaceName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	blobLease.HeldByServer = held
+	blobLease.ServerOperationId = operationId
+
+	c.IndentedJSON(http.StatusOK, blobLease)
+}
+
+func (s *StorageAccountHandler) ListStateSnapshots(c *gin.Context) {
+	workspaceName := c.Param("workspaceName")
+	if workspaceName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "workspaceName is required"})
+		return
+	}
+
+	storageAccountName, err := s.storageAccountService.GetStorageAccountName()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	snapshots, err := s.storageAccountService.ListStateSnapshots(storageAccountName, entity.TfStateContainerName, workspaceName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, snapshots)
+}
+
+func (s *StorageAccountHandler) RestoreStateSnapshot(c *gin.Context) {
+	workspaceName := c.Param("workspaceName")
+	snapshotId := c.Param("snapshotId")
+	if workspaceName == "" || snapshotId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "workspaceName and snapshotId are required"})
+		return
+	}
+
+	storageAccountName, err := s.storageAccountService.GetStorageAccountName()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.storageAccountService.RestoreStateSnapshot(storageAccountName, entity.TfStateContainerName, workspaceName, snapshotId); err != nil {
+		switch {
+		case errors.Is(err, entity.ErrBlobNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, entity.ErrBlobLeased):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	// Invalidate workspace cache, resources and outputs come from the state.
+	if err := s.workspaceService.DeleteAllWorkspaceFromRedis(); err != nil {
+		slog.Error("not able to invalidate workspace cache", err)
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+func (s *StorageAccountHandler) GetLeaseBreakAudits(c *gin.Context) {
+	audits, err := s.storageAccountService.GetLeaseBreakAudits()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, audits)
+}
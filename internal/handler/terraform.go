@@ -1,11 +1,14 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 
 	"one-click-aks-server/internal/entity"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/google/uuid"
 
 	"one-click-aks-server/internal/helper"
@@ -17,16 +20,25 @@ type terraformHandler struct {
 	terraformService    entity.TerraformService
 	actionStatusService entity.ActionStatusService
 	deploymentService   entity.DeploymentService
+	operationService    entity.OperationService
+	labService          entity.LabService
+	labBinding          binding.Binding
 }
 
 func NewTerraformWithActionStatusHandler(r *gin.RouterGroup,
 	service entity.TerraformService,
 	actionStatusService entity.ActionStatusService,
-	deploymentService entity.DeploymentService) {
+	deploymentService entity.DeploymentService,
+	operationService entity.OperationService,
+	labService entity.LabService,
+	strictLabBinding bool) {
 	handler := &terraformHandler{
 		terraformService:    service,
 		actionStatusService: actionStatusService,
 		deploymentService:   deploymentService,
+		operationService:    operationService,
+		labService:          labService,
+		labBinding:          helperLabBinding(strictLabBinding),
 	}
 
 	r.POST("/terraform/init/:operationId", handler.Init)
@@ -36,7 +48,31 @@ func NewTerraformWithActionStatusHandler(r *gin.RouterGroup,
 	r.POST("/terraform/extend/:mode/:operationId", handler.Extend)
 }
 
+// Routes that must be available while an action is in progress.
+func NewTerraformHandler(r *gin.RouterGroup,
+	service entity.TerraformService,
+	actionStatusService entity.ActionStatusService,
+	deploymentService entity.DeploymentService,
+	operationService entity.OperationService,
+	labService entity.LabService) {
+	handler := &terraformHandler{
+		terraformService:    service,
+		actionStatusService: actionStatusService,
+		deploymentService:   deploymentService,
+		operationService:    operationService,
+		labService:          labService,
+	}
+
+	r.POST("/terraform/cancel/:operationId", handler.Cancel)
+	r.GET("/terraform/plan/:operationId/result", handler.GetPlanResult)
+}
+
 func (t *terraformHandler) Init(c *gin.Context) {
+	// init isn't tied to a workspace, whole server is locked.
+	if !helperAcquireActionLock(c, t.actionStatusService, "") {
+		return
+	}
+
 	notification := entity.ServerNotification{
 		Id:               uuid.New().String(),
 		NotificationType: entity.Info,
@@ -48,10 +84,26 @@ func (t *terraformHandler) Init(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 	}
 
+	operation, err := t.operationService.StartOperation(entity.Operation{
+		OperationId: c.Param("operationId"),
+		Action:      "init",
+		UserId:      helperUserPrincipal(c),
+		Status:      entity.InitInProgress,
+	})
+	if err != nil {
+		slog.Error("Error starting operation", err)
+	}
+
 	// Start the long-running operation in a goroutine
 	go func() {
-		t.actionStatusService.SetActionStart()
-		if err := t.terraformService.Init(); err != nil {
+		status := entity.InitCompleted
+		err := t.terraformService.Init(operation)
+		if errors.Is(err, entity.ErrOperationCancelled) {
+			status = entity.InitCancelled
+			notification.NotificationType = entity.Warning
+			notification.Message = string(entity.InitCancelled)
+		} else if err != nil {
+			status = entity.InitFailed
 			notification.NotificationType = entity.Error
 			notification.Message = string(entity.InitFailed)
 		} else {
@@ -61,8 +113,11 @@ func (t *terraformHandler) Init(c *gin.Context) {
 		if err := t.actionStatusService.SetServerNotification(notification); err != nil {
 			slog.Error("Error setting server notification", err)
 		}
-		if err := t.actionStatusService.SetActionEnd(); err != nil {
-			slog.Error("Error setting action end", err)
+		if _, err := t.operationService.EndOperation(operation, status, err); err != nil {
+			slog.Error("Error ending operation", err)
+		}
+		if err := t.actionStatusService.ReleaseActionLock(""); err != nil {
+			slog.Error("Error releasing action lock", err)
 		}
 	}()
 
@@ -72,13 +127,25 @@ func (t *terraformHandler) Init(c *gin.Context) {
 
 func (t *terraformHandler) Plan(c *gin.Context) {
 	deployment := entity.Deployment{}
-	if err := c.Bind(&deployment); err != nil {
+	if err := c.ShouldBindWith(&deployment, t.labBinding); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	if !helperValidateWorkspace(c, deployment.DeploymentWorkspace) {
+		return
+	}
+
 	lab := deployment.DeploymentLab
 
+	if !helperValidateLab(c, t.labService, lab) {
+		return
+	}
+
+	if !helperAcquireActionLock(c, t.actionStatusService, deployment.DeploymentWorkspace) {
+		return
+	}
+
 	notification := entity.ServerNotification{
 		Id:               uuid.New().String(),
 		NotificationType: entity.Info,
@@ -90,21 +157,50 @@ func (t *terraformHandler) Plan(c *gin.Context) {
 		slog.Error("Error setting server notification", err)
 	}
 
+	templateHash, err := helper.TemplateHash(lab.Template)
+	if err != nil {
+		slog.Error("Error hashing lab template", err)
+	}
+
+	operation, err := t.operationService.StartOperation(entity.Operation{
+		OperationId:  c.Param("operationId"),
+		Action:       "plan",
+		Workspace:    deployment.DeploymentWorkspace,
+		LabId:        lab.Id,
+		LabName:      lab.Name,
+		UserId:       helperUserPrincipal(c),
+		Status:       entity.PlanInProgress,
+		TemplateHash: templateHash,
+	})
+	if err != nil {
+		slog.Error("Error starting operation", err)
+	}
+
 	// Start the long-running operation in a goroutine
 	go func() {
-		t.actionStatusService.SetActionStart()
-		if err := t.terraformService.Plan(lab); err != nil {
+		status := entity.PlanCompleted
+		planResult, err := t.terraformService.Plan(operation, lab)
+		if errors.Is(err, entity.ErrOperationCancelled) {
+			status = entity.PlanCancelled
+			notification.NotificationType = entity.Warning
+			notification.Message = string(entity.PlanCancelled)
+		} else if err != nil {
+			status = entity.PlanFailed
 			notification.NotificationType = entity.Error
 			notification.Message = string(entity.PlanFailed)
 		} else {
 			notification.NotificationType = entity.Success
 			notification.Message = string(entity.PlanCompleted)
+			operation.PlanResult = &planResult
 		}
 		if err := t.actionStatusService.SetServerNotification(notification); err != nil {
 			slog.Error("Error setting server notification", err)
 		}
-		if err := t.actionStatusService.SetActionEnd(); err != nil {
-			slog.Error("Error setting action end", err)
+		if _, err := t.operationService.EndOperation(operation, status, err); err != nil {
+			slog.Error("Error ending operation", err)
+		}
+		if err := t.actionStatusService.ReleaseActionLock(deployment.DeploymentWorkspace); err != nil {
+			slog.Error("Error releasing action lock", err)
 		}
 	}()
 
@@ -115,13 +211,53 @@ func (t *terraformHandler) Plan(c *gin.Context) {
 func (t *terraformHandler) Apply(c *gin.Context) {
 
 	deployment := entity.Deployment{}
-	if err := c.Bind(&deployment); err != nil {
+	if err := c.ShouldBindWith(&deployment, t.labBinding); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	if !helperValidateWorkspace(c, deployment.DeploymentWorkspace) {
+		return
+	}
+
 	lab := deployment.DeploymentLab
 
+	if !helperValidateLab(c, t.labService, lab) {
+		return
+	}
+
+	if !helperAcquireActionLock(c, t.actionStatusService, deployment.DeploymentWorkspace) {
+		return
+	}
+
+	templateHash, err := helper.TemplateHash(lab.Template)
+	if err != nil {
+		t.actionStatusService.ReleaseActionLock(deployment.DeploymentWorkspace)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Apply exactly what was reviewed if plan is provided.
+	planId := c.Query("planId")
+	if planId != "" {
+		if status, err := t.helperValidatePlanForApply(planId, deployment.DeploymentWorkspace, templateHash); err != nil {
+			t.actionStatusService.ReleaseActionLock(deployment.DeploymentWorkspace)
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	targets := c.QueryArray("target")
+	if len(targets) > 0 && planId != "" {
+		t.actionStatusService.ReleaseActionLock(deployment.DeploymentWorkspace)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "target can't be used when applying a saved plan"})
+		return
+	}
+
+	if !t.helperValidateTargets(c, deployment.DeploymentWorkspace, targets) {
+		return
+	}
+
 	notification := entity.ServerNotification{
 		Id:               uuid.New().String(),
 		NotificationType: entity.Info,
@@ -129,36 +265,65 @@ func (t *terraformHandler) Apply(c *gin.Context) {
 		AutoClose:        2000,
 	}
 
+	operation, err := t.operationService.StartOperation(entity.Operation{
+		OperationId:  c.Param("operationId"),
+		Action:       "apply",
+		Workspace:    deployment.DeploymentWorkspace,
+		LabId:        lab.Id,
+		LabName:      lab.Name,
+		UserId:       helperUserPrincipal(c),
+		Status:       entity.DeploymentInProgress,
+		TemplateHash: templateHash,
+		PlanId:       planId,
+		Targeted:     len(targets) > 0,
+		Targets:      targets,
+	})
+	if err != nil {
+		slog.Error("Error starting operation", err)
+	}
+
 	// Start the long-running operation in a goroutine
 	go func() {
 		deployment.DeploymentStatus = entity.DeploymentInProgress
+		deployment.DeploymentStatusReason = ""
 		helper.CalculateNewEpochTimeForDeployment(&deployment)
 		if err := t.deploymentService.UpsertDeployment(deployment); err != nil {
 			slog.Error("Error updating deployment", err)
 		}
-		t.actionStatusService.SetActionStart()
 		if err := t.actionStatusService.SetServerNotification(notification); err != nil {
 			slog.Error("Error setting server notification", err)
 		}
-		if err := t.terraformService.Apply(lab); err != nil {
+		err := t.terraformService.Apply(operation, lab)
+		if errors.Is(err, entity.ErrOperationCancelled) {
+			notification.NotificationType = entity.Warning
+			notification.Message = string(entity.DeploymentCancelled)
+			deployment.DeploymentStatus = entity.DeploymentCancelled
+		} else if err != nil {
 			notification.NotificationType = entity.Error
 			notification.Message = string(entity.DeploymentFailed) + ". " + err.Error()
 			notification.AutoClose = 5000
 			deployment.DeploymentStatus = entity.DeploymentFailed
+			deployment.DeploymentStatusReason = err.Error()
 		} else {
 			notification.NotificationType = entity.Success
 			notification.Message = string(entity.DeploymentCompleted)
 			deployment.DeploymentStatus = entity.DeploymentCompleted
+			// infrastructure matches the lab again.
+			deployment.DeploymentDriftStatus = ""
+			deployment.DeploymentDriftedResources = []string{}
 		}
 		if err := t.actionStatusService.SetServerNotification(notification); err != nil {
 			slog.Error("Error setting server notification", err)
 		}
+		if _, err := t.operationService.EndOperation(operation, deployment.DeploymentStatus, err); err != nil {
+			slog.Error("Error ending operation", err)
+		}
 		helper.CalculateNewEpochTimeForDeployment(&deployment)
 		if err := t.deploymentService.UpsertDeployment(deployment); err != nil {
 			slog.Error("Error updating deployment", err)
 		}
-		if err := t.actionStatusService.SetActionEnd(); err != nil {
-			slog.Error("Error setting action end", err)
+		if err := t.actionStatusService.ReleaseActionLock(deployment.DeploymentWorkspace); err != nil {
+			slog.Error("Error releasing action lock", err)
 		}
 	}()
 
@@ -170,13 +335,21 @@ func (t *terraformHandler) Extend(c *gin.Context) {
 	mode := c.Param("mode")
 
 	deployment := entity.Deployment{}
-	if err := c.Bind(&deployment); err != nil {
+	if err := c.ShouldBindWith(&deployment, t.labBinding); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	if !helperValidateWorkspace(c, deployment.DeploymentWorkspace) {
+		return
+	}
+
 	lab := deployment.DeploymentLab
 
+	if !helperAcquireActionLock(c, t.actionStatusService, deployment.DeploymentWorkspace) {
+		return
+	}
+
 	notification := entity.ServerNotification{
 		Id:               uuid.New().String(),
 		NotificationType: entity.Info,
@@ -188,15 +361,30 @@ func (t *terraformHandler) Extend(c *gin.Context) {
 		slog.Error("Error setting server notification", err)
 	}
 
+	operation, err := t.operationService.StartOperation(entity.Operation{
+		OperationId: c.Param("operationId"),
+		Action:      "extend",
+		Mode:        mode,
+		Workspace:   deployment.DeploymentWorkspace,
+		LabId:       lab.Id,
+		LabName:     lab.Name,
+		UserId:      helperUserPrincipal(c),
+		Status:      entity.ExtendInProgress,
+	})
+	if err != nil {
+		slog.Error("Error starting operation", err)
+	}
+
 	// Start the long-running operation in a goroutine
 	go func() {
-		if err := t.actionStatusService.SetActionStart(); err != nil {
-			slog.Error("Error setting action start", err)
-			notification.NotificationType = entity.Error
-			notification.Message = mode + " failed : Not able to update action status."
-			return
-		}
-		if err := t.terraformService.Extend(lab, mode); err != nil {
+		status := entity.ExtendCompleted
+		err := t.terraformService.Extend(operation, lab, mode)
+		if errors.Is(err, entity.ErrOperationCancelled) {
+			status = entity.ExtendCancelled
+			notification.NotificationType = entity.Warning
+			notification.Message = mode + " cancelled."
+		} else if err != nil {
+			status = entity.ExtendFailed
 			notification.NotificationType = entity.Error
 			notification.AutoClose = 5000
 			notification.Message = mode + " failed. " + err.Error()
@@ -207,8 +395,12 @@ func (t *terraformHandler) Extend(c *gin.Context) {
 		if err := t.actionStatusService.SetServerNotification(notification); err != nil {
 			slog.Error("Error setting server notification", err)
 		}
-		if err := t.actionStatusService.SetActionEnd(); err != nil {
-			slog.Error("Error setting action end", err)
+		if _, err := t.operationService.EndOperation(operation, status, err); err != nil {
+			slog.Error("Error ending operation", err)
+		}
+		t.helperRecordExtendStatus(deployment, status, err)
+		if err := t.actionStatusService.ReleaseActionLock(deployment.DeploymentWorkspace); err != nil {
+			slog.Error("Error releasing action lock", err)
 		}
 	}()
 
@@ -218,13 +410,26 @@ func (t *terraformHandler) Extend(c *gin.Context) {
 
 func (t *terraformHandler) Destroy(c *gin.Context) {
 	deployment := entity.Deployment{}
-	if err := c.Bind(&deployment); err != nil {
+	if err := c.ShouldBindWith(&deployment, t.labBinding); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	if !helperValidateWorkspace(c, deployment.DeploymentWorkspace) {
+		return
+	}
+
 	lab := deployment.DeploymentLab
 
+	if !helperAcquireActionLock(c, t.actionStatusService, deployment.DeploymentWorkspace) {
+		return
+	}
+
+	targets := c.QueryArray("target")
+	if !t.helperValidateTargets(c, deployment.DeploymentWorkspace, targets) {
+		return
+	}
+
 	notification := entity.ServerNotification{
 		Id:               uuid.New().String(),
 		NotificationType: entity.Info,
@@ -232,36 +437,222 @@ func (t *terraformHandler) Destroy(c *gin.Context) {
 		AutoClose:        2000,
 	}
 
+	operation, err := t.operationService.StartOperation(entity.Operation{
+		OperationId: c.Param("operationId"),
+		Action:      "destroy",
+		Workspace:   deployment.DeploymentWorkspace,
+		LabId:       lab.Id,
+		LabName:     lab.Name,
+		UserId:      helperUserPrincipal(c),
+		Status:      entity.DestroyInProgress,
+		Targeted:    len(targets) > 0,
+		Targets:     targets,
+	})
+	if err != nil {
+		slog.Error("Error starting operation", err)
+	}
+
 	// Start the long-running operation in a goroutine
 	go func() {
+		previousStatus := deployment.DeploymentStatus
 		deployment.DeploymentStatus = entity.DestroyInProgress
+		deployment.DeploymentStatusReason = ""
 		if err := t.deploymentService.UpsertDeployment(deployment); err != nil {
 			slog.Error("Error updating deployment", err)
 		}
-		t.actionStatusService.SetActionStart()
 		if err := t.actionStatusService.SetServerNotification(notification); err != nil {
 			slog.Error("Error setting server notification", err)
 		}
-		if err := t.terraformService.Destroy(lab); err != nil {
+		err := t.terraformService.Destroy(operation, lab)
+		if errors.Is(err, entity.ErrOperationCancelled) {
+			notification.NotificationType = entity.Warning
+			notification.Message = string(entity.DestroyCancelled)
+			deployment.DeploymentStatus = entity.DestroyCancelled
+		} else if err != nil {
 			notification.NotificationType = entity.Error
-			notification.Message = string(entity.DestroyFailed)
+			notification.Message = string(entity.DestroyFailed) + ". " + err.Error()
+			notification.AutoClose = 5000
 			deployment.DeploymentStatus = entity.DestroyFailed
+			deployment.DeploymentStatusReason = err.Error()
 		} else {
 			notification.NotificationType = entity.Success
 			notification.Message = string(entity.DestroyCompleted)
 			deployment.DeploymentStatus = entity.DestroyCompleted
+			// rest of the deployment is still there.
+			if operation.Targeted {
+				deployment.DeploymentStatus = previousStatus
+			}
 		}
 		if err := t.actionStatusService.SetServerNotification(notification); err != nil {
 			slog.Error("Error setting server notification", err)
 		}
+		if _, err := t.operationService.EndOperation(operation, deployment.DeploymentStatus, err); err != nil {
+			slog.Error("Error ending operation", err)
+		}
 		if err := t.deploymentService.UpsertDeployment(deployment); err != nil {
 			slog.Error("Error updating deployment", err)
 		}
-		if err := t.actionStatusService.SetActionEnd(); err != nil {
-			slog.Error("Error setting action end", err)
+		if err := t.actionStatusService.ReleaseActionLock(deployment.DeploymentWorkspace); err != nil {
+			slog.Error("Error releasing action lock", err)
 		}
 	}()
 
 	// Respond back to the request with the operation ID
 	c.Status(http.StatusAccepted)
 }
+
+// Interrupts the running process of the operation.
+// Action lock is released and deployment status is updated by the goroutine running the operation once the process exits.
+func (t *terraformHandler) Cancel(c *gin.Context) {
+	operationId := c.Param("operationId")
+
+	operation, err := t.operationService.GetOperation(operationId)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "operation not found"})
+		return
+	}
+
+	if !operation.InProgress {
+		c.JSON(http.StatusConflict, gin.H{"error": "operation is not in progress"})
+		return
+	}
+
+	if err := t.terraformService.Cancel(operationId); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	notification := entity.ServerNotification{
+		Id:               uuid.New().String(),
+		NotificationType: entity.Warning,
+		Message:          "Cancelling " + operation.Action + " operation.",
+		AutoClose:        2000,
+	}
+
+	if err := t.actionStatusService.SetServerNotification(notification); err != nil {
+		slog.Error("Error setting server notification", err)
+	}
+
+	c.Status(http.StatusAccepted)
+}
+
+func (t *terraformHandler) GetPlanResult(c *gin.Context) {
+	operation, err := t.operationService.GetOperation(c.Param("operationId"))
+	if err != nil || operation.Action != "plan" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "plan operation not found"})
+		return
+	}
+
+	if operation.InProgress {
+		c.JSON(http.StatusConflict, gin.H{"error": "plan is in progress"})
+		return
+	}
+
+	if operation.PlanResult == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "plan has no result, status : " + string(operation.Status)})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, operation.PlanResult)
+}
+
+// Responds with bad request and releases the workspace lock if targets are not in workspace.
+func (t *terraformHandler) helperValidateTargets(c *gin.Context, workspace string, targets []string) bool {
+	if len(targets) == 0 {
+		return true
+	}
+
+	if err := t.terraformService.ValidateTargets(workspace, targets); err != nil {
+		t.actionStatusService.ReleaseActionLock(workspace)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	return true
+}
+
+// Extend script doesn't change deployment unless it failed or was cancelled, then deployment
+// keeps the status and why it failed. Latest deployment is loaded, request may carry an old one.
+// Successful run clears status of an earlier failed run.
+func (t *terraformHandler) helperRecordExtendStatus(deployment entity.Deployment, status entity.DeploymentStatus, extendErr error) {
+	latestDeployment, err := t.deploymentService.GetDeployment(deployment.DeploymentUserId, deployment.DeploymentWorkspace, deployment.DeploymentSubscriptionId)
+	if err != nil {
+		slog.Error("Error getting deployment", err)
+		return
+	}
+
+	switch {
+	case extendErr != nil:
+		latestDeployment.DeploymentStatus = status
+		latestDeployment.DeploymentStatusReason = ""
+		if status == entity.ExtendFailed {
+			latestDeployment.DeploymentStatusReason = extendErr.Error()
+		}
+	case latestDeployment.DeploymentStatus == entity.ExtendFailed || latestDeployment.DeploymentStatus == entity.ExtendCancelled:
+		latestDeployment.DeploymentStatus = status
+		latestDeployment.DeploymentStatusReason = ""
+	default:
+		return
+	}
+
+	if err := t.deploymentService.UpsertDeployment(latestDeployment); err != nil {
+		slog.Error("Error updating deployment", err)
+	}
+}
+
+// Responds with bad request if workspace isn't a terraform workspace name.
+// Workspace names end up in paths of terraform directories on the server.
+func helperValidateWorkspace(c *gin.Context, workspace string) bool {
+	if !helper.ValidWorkspaceName(workspace) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": entity.ErrInvalidWorkspaceName.Error()})
+		return false
+	}
+	return true
+}
+
+// Locks the workspace for the operation on the route. Responds with conflict
+// if an action is already in progress on the workspace.
+func helperAcquireActionLock(c *gin.Context, actionStatusService entity.ActionStatusService, workspace string) bool {
+	err := actionStatusService.AcquireActionLock(workspace, c.Param("operationId"))
+	if errors.Is(err, entity.ErrActionInProgress) {
+		c.JSON(http.StatusConflict, gin.H{"error": "action in progress on workspace " + workspace})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+
+	return true
+}
+
+// Saved plan can be applied only if it completed and neither workspace nor template changed since.
+// Returns http status to respond with if plan can't be applied.
+func (t *terraformHandler) helperValidatePlanForApply(planId string, workspace string, templateHash string) (int, error) {
+	plan, err := t.operationService.GetOperation(planId)
+	if err != nil || plan.Action != "plan" {
+		return http.StatusNotFound, errors.New("plan " + planId + " not found")
+	}
+
+	if plan.Status != entity.PlanCompleted {
+		return http.StatusConflict, errors.New("plan " + planId + " is not completed, status : " + string(plan.Status))
+	}
+
+	if plan.Workspace != workspace {
+		return http.StatusConflict, errors.New("workspace changed since plan was made, plan again")
+	}
+
+	if plan.TemplateHash != templateHash {
+		return http.StatusConflict, errors.New("lab template changed since plan was made, plan again")
+	}
+
+	return http.StatusOK, nil
+}
+
+// user principal of the caller. auth middleware already verified the token.
+func helperUserPrincipal(c *gin.Context) string {
+	authToken := c.GetHeader("Authorization")
+	authToken = strings.TrimPrefix(authToken, "Bearer ")
+	userPrincipal, _ := helper.GetUserPrincipalFromMSALAuthToken(authToken)
+	return userPrincipal
+}
@@ -1,7 +1,9 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"one-click-aks-server/internal/entity"
 
@@ -9,19 +11,46 @@ import (
 )
 
 type WorkspaceHandler struct {
-	WorkspaceService entity.WorkspaceService
+	WorkspaceService  entity.WorkspaceService
+	DeploymentService entity.DeploymentService
 }
 
-func NewWorkspaceHandler(r *gin.RouterGroup, service entity.WorkspaceService) {
+func NewWorkspaceHandler(r *gin.RouterGroup, service entity.WorkspaceService, deploymentService entity.DeploymentService) {
 	handler := &WorkspaceHandler{
-		WorkspaceService: service,
+		WorkspaceService:  service,
+		DeploymentService: deploymentService,
 	}
 
 	r.GET("/workspace", handler.ListWorkspaces)
 	r.GET("/resources", handler.GetResources)
 }
 
+func NewWorkspaceWithActionStatusHandler(r *gin.RouterGroup, service entity.WorkspaceService, deploymentService entity.DeploymentService) {
+	handler := &WorkspaceHandler{
+		WorkspaceService:  service,
+		DeploymentService: deploymentService,
+	}
+
+	r.POST("/workspace/reconcile", handler.ReconcileOrphans)
+}
+
 func (w *WorkspaceHandler) ListWorkspaces(c *gin.Context) {
+	details, err := helperBoolQuery(c, "details")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if details {
+		workspaceDetails, err := w.DeploymentService.GetWorkspaceDetails(helperUserPrincipal(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.IndentedJSON(http.StatusOK, workspaceDetails)
+		return
+	}
+
 	workspaces, err := w.WorkspaceService.List()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -31,11 +60,42 @@ func (w *WorkspaceHandler) ListWorkspaces(c *gin.Context) {
 }
 
 func (w *WorkspaceHandler) GetResources(c *gin.Context) {
-	resources, err := w.WorkspaceService.Resources()
+	resources, err := w.WorkspaceService.Resources(c.QueryArray("type"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.String(http.StatusOK, resources)
+	c.IndentedJSON(http.StatusOK, resources)
+}
+
+// Without confirm=true, only returns what would be done.
+func (w *WorkspaceHandler) ReconcileOrphans(c *gin.Context) {
+	confirm, err := helperBoolQuery(c, "confirm")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	actions, err := w.DeploymentService.ReconcileOrphans(helperUserPrincipal(c), confirm)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, actions)
+}
+
+// false if query param is not set.
+func helperBoolQuery(c *gin.Context, key string) (bool, error) {
+	val := c.Query(key)
+	if val == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, errors.New(key + " must be true or false")
+	}
+	return b, nil
 }
@@ -4,11 +4,15 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"reflect"
+	"regexp"
 	"strings"
 	"time"
 	"unicode"
@@ -16,12 +20,22 @@ import (
 
 	"one-click-aks-server/internal/entity"
 
+	"github.com/Rican7/conjson"
+	"github.com/Rican7/conjson/transform"
 	"github.com/golang-jwt/jwt"
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jwk"
 	"golang.org/x/exp/slog"
 )
 
+// names terraform allows for workspaces, they are used in paths too.
+var workspaceNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ValidWorkspaceName reports whether name is a terraform workspace name and safe to use as a directory name.
+func ValidWorkspaceName(name string) bool {
+	return workspaceNamePattern.MatchString(name)
+}
+
 var alphabet = []byte("abcdefghijklmnopqrstuvwxyz0123456789")
 
 func Generate(size int) string {
@@ -171,3 +185,53 @@ func CalculateNewEpochTimeForDeployment(deployment *entity.Deployment) {
 		deployment.DeploymentAutoDeleteUnixTime = deployment.DeploymentLifespan + epochTime
 	}
 }
+
+// TemplateHash identifies the lab template, used to find out if template changed since it was planned.
+func TemplateHash(template entity.TfvarConfigType) (string, error) {
+	val, err := json.Marshal(template)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(val)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// LeaseAge is time since terraform created the lock on state blob, or since the blob
+// last changed if lock info is missing. Terraform sets lock info when it takes the lease.
+func LeaseAge(blobLease entity.BlobLease) time.Duration {
+	since := blobLease.LockCreated
+	if since == 0 {
+		since = blobLease.LastModified
+	}
+	return time.Since(time.Unix(since, 0))
+}
+
+// TfvarVariables are terraform variables of lab template in order of its fields. Variable names and
+// keys of values are conventional (snake case), that's what tf/ expects.
+// Fields that are null are skipped to let terraform use its default.
+func TfvarVariables(tfvar entity.TfvarConfigType) []entity.TfvarVariable {
+	variables := []entity.TfvarVariable{}
+
+	tr := reflect.TypeOf(tfvar)
+	// Loop over the fields in the struct.
+	for i := 0; i < tr.NumField(); i++ {
+		// Get the field and its value at the current index.
+		field := tr.Field(i)
+		value := reflect.ValueOf(tfvar).Field(i)
+
+		encoded, _ := json.Marshal(conjson.NewMarshaler(value.Interface(), transform.ConventionalKeys()))
+
+		slog.Debug("Field :" + field.Name + " Encoded String : " + string(encoded))
+
+		// If a variable doesn't exist, just skip it and let terraform default do the magic.
+		if string(encoded) != "null" {
+			variables = append(variables, entity.TfvarVariable{
+				Name:  CamelToConventional(field.Name),
+				Value: string(encoded),
+			})
+		}
+	}
+
+	return variables
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 
 	"one-click-aks-server/internal/entity"
@@ -10,33 +11,20 @@ import (
 )
 
 // ActionStatusMiddleware checks for already running operation and rejects new requests.
+// Whole server is locked while the request is handled.
 func ActionStatusMiddleware(actionStatusService entity.ActionStatusService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-
-		actionStatus, err := actionStatusService.GetActionStatus()
-		if err != nil {
-			slog.Error("not able to get current action status", err)
-
-			// Defaulting to no action
-			actionStatus := entity.ActionStatus{
-				InProgress: false,
-			}
-			if err := actionStatusService.SetActionStatus(actionStatus); err != nil {
-				slog.Error("not able to set default action status.", err)
-				c.AbortWithStatus(http.StatusInternalServerError)
+		if err := actionStatusService.SetActionStart(); err != nil {
+			if errors.Is(err, entity.ErrActionInProgress) {
+				slog.Info("action in progress")
+				c.AbortWithStatus(http.StatusConflict)
 				return
 			}
-		}
-
-		if actionStatus.InProgress {
-			slog.Info("action in progress")
-			c.AbortWithStatus(http.StatusConflict)
+			slog.Error("not able to set action start", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
 			return
 		}
 
-		// set action status
-		actionStatusService.SetActionStart()
-
 		defer func() {
 			// reset action status
 			actionStatusService.SetActionEnd()
@@ -59,6 +59,44 @@ func (a *actionStatusRepository) WaitForActionStatusChange() (string, error) {
 	}
 }
 
+const actionLocksKey = "action-locks"
+
+// Empty workspace is the server wide lock, it can only be taken when no other lock is held
+// and no workspace can be locked while it is held.
+var acquireActionLockScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[1], '') == 1 then
+	return 0
+end
+if ARGV[1] == '' and redis.call('HLEN', KEYS[1]) > 0 then
+	return 0
+end
+return redis.call('HSETNX', KEYS[1], ARGV[1], ARGV[2])
+`)
+
+func (a *actionStatusRepository) AcquireActionLock(workspace string, operationId string) (bool, error) {
+	rdb := newActionStatusRedisClient()
+	acquired, err := acquireActionLockScript.Run(actionStatusCtx, rdb, []string{actionLocksKey}, workspace, operationId).Int()
+	if err != nil {
+		return false, err
+	}
+	return acquired == 1, nil
+}
+
+func (a *actionStatusRepository) ReleaseActionLock(workspace string) error {
+	rdb := newActionStatusRedisClient()
+	return rdb.HDel(actionStatusCtx, actionLocksKey, workspace).Err()
+}
+
+func (a *actionStatusRepository) GetActionLocks() (map[string]string, error) {
+	rdb := newActionStatusRedisClient()
+	return rdb.HGetAll(actionStatusCtx, actionLocksKey).Result()
+}
+
+func (a *actionStatusRepository) DeleteActionLocks() error {
+	rdb := newActionStatusRedisClient()
+	return rdb.Del(actionStatusCtx, actionLocksKey).Err()
+}
+
 func (a *actionStatusRepository) SetTerraformOperation(val string) error {
 	rdb := newActionStatusRedisClient()
 	if err := rdb.Set(actionStatusCtx, "terraform-operation", val, 0).Err(); err != nil {
@@ -34,9 +34,7 @@ func (d *deploymentRepository) GetDeployments() ([]entity.Deployment, error) {
 	return nil, nil
 }
 
-func (d *deploymentRepository) GetMyDeployments(userId string, subscriptionId string) ([]entity.Deployment, error) {
-	deployments := []entity.Deployment{}
-
+func (d *deploymentRepository) GetMyDeployments(userId string, subscriptionId string) (string, error) {
 	// check if user deployments already exist in redis
 	deploymentsString, err := d.rdb.Get(ctx, userId+"-deployments").Result()
 	if err != nil {
@@ -46,16 +44,15 @@ func (d *deploymentRepository) GetMyDeployments(userId string, subscriptionId st
 		)
 	}
 	if deploymentsString != "" {
-		if err := json.Unmarshal([]byte(deploymentsString), &deployments); err == nil {
+		if json.Valid([]byte(deploymentsString)) {
 			slog.Debug("deployments found in redis ",
 				slog.String("userId", userId),
 			)
 
-			return deployments, nil
+			return deploymentsString, nil
 		}
-		slog.Debug("error unmarshal deployment found in redis continue to get from table storage ",
+		slog.Debug("deployments found in redis are not valid json continue to get from table storage ",
 			slog.String("userId", userId),
-			slog.String("error", err.Error()),
 		)
 	}
 
@@ -63,13 +60,13 @@ func (d *deploymentRepository) GetMyDeployments(userId string, subscriptionId st
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
 		slog.Error("error getting deployments ", err)
-		return nil, err
+		return "", err
 	}
 
 	armAccessToken, err := d.auth.GetARMAccessToken()
 	if err != nil {
 		slog.Error("error getting arm access token ", err)
-		return nil, err
+		return "", err
 	}
 
 	req.Header.Set("Authorization", "Bearer "+armAccessToken)
@@ -83,32 +80,30 @@ func (d *deploymentRepository) GetMyDeployments(userId string, subscriptionId st
 	resp, err := client.Do(req)
 	if err != nil {
 		slog.Error("error getting deployments ", err)
-		return nil, err
+		return "", err
 	}
 	defer resp.Body.Close()
 
+	// treated as no deployments.
 	if resp.StatusCode != http.StatusOK {
 		slog.Error("error getting deployments ", err)
-		return nil, err
+		return "[]", err
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&deployments); err != nil {
-		slog.Error("error unmarshal deployments ", err)
-		return nil, err
-	}
-
-	// save deployments to redis
-	marshalledDeployments, err := json.Marshal(deployments)
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		slog.Debug("error occurred marshalling the deployments record.",
-			slog.String("userId", userId),
-			slog.String("error", err.Error()),
-		)
+		slog.Error("error reading deployments ", err)
+		return "", err
+	}
 
-		return deployments, err
+	if !json.Valid(body) {
+		err := errors.New("deployments are not valid json")
+		slog.Error("error reading deployments ", err)
+		return "", err
 	}
 
-	err = d.rdb.Set(ctx, userId+"-deployments", marshalledDeployments, 0).Err()
+	// save deployments to redis
+	err = d.rdb.Set(ctx, userId+"-deployments", string(body), 0).Err()
 	if err != nil {
 		slog.Debug("error occurred saving the deployments record to redis.",
 			slog.String("userId", userId),
@@ -116,12 +111,10 @@ func (d *deploymentRepository) GetMyDeployments(userId string, subscriptionId st
 		)
 	}
 
-	return deployments, nil
+	return string(body), nil
 }
 
-func (d *deploymentRepository) GetDeployment(userId string, workspace string, subscriptionId string) (entity.Deployment, error) {
-	deployment := entity.Deployment{}
-
+func (d *deploymentRepository) GetDeployment(userId string, workspace string, subscriptionId string) (string, error) {
 	// check if deployment already exist in redis
 	deploymentString, err := d.rdb.Get(ctx, userId+"-"+subscriptionId+"-"+workspace).Result()
 	if err != nil {
@@ -133,48 +126,51 @@ func (d *deploymentRepository) GetDeployment(userId string, workspace string, su
 		)
 	}
 	if deploymentString != "" {
-		if err := json.Unmarshal([]byte(deploymentString), &deployment); err == nil {
+		if json.Valid([]byte(deploymentString)) {
 			slog.Debug("deployment found in redis ",
 				slog.String("userId", userId),
 				slog.String("subscriptionId", subscriptionId),
 				slog.String("workspace", workspace),
 			)
 
-			return deployment, nil
+			return deploymentString, nil
 		}
-		slog.Debug("error unmarshal deployment found in redis continue to get from table storage ",
+		slog.Debug("deployment found in redis is not valid json continue to get from table storage ",
 			slog.String("userId", userId),
 			slog.String("subscriptionId", subscriptionId),
 			slog.String("workspace", workspace),
-			slog.String("error", err.Error()),
 		)
 	}
 
-	deployments, err := d.GetMyDeployments(userId, subscriptionId)
+	deploymentsString, err := d.GetMyDeployments(userId, subscriptionId)
 	if err != nil {
 		slog.Error("error getting deployments ", err)
-		return entity.Deployment{}, err
+		return "", err
 	}
 
-	for _, deployment := range deployments {
-		if deployment.DeploymentWorkspace == workspace &&
-			deployment.DeploymentUserId == userId &&
-			deployment.DeploymentSubscriptionId == subscriptionId {
+	// only keys are decoded, lab is left as is.
+	deployments := []json.RawMessage{}
+	if err := json.Unmarshal([]byte(deploymentsString), &deployments); err != nil {
+		slog.Error("error unmarshal deployments ", err)
+		return "", err
+	}
 
-			// save deployment to redis
-			marshalledDeployment, err := json.Marshal(deployment)
-			if err != nil {
-				slog.Debug("error occurred marshalling the deployment record.",
-					slog.String("userId", userId),
-					slog.String("subscriptionId", subscriptionId),
-					slog.String("workspace", workspace),
-					slog.String("error", err.Error()),
-				)
+	for _, deployment := range deployments {
+		key := struct {
+			DeploymentUserId         string `json:"deploymentUserId"`
+			DeploymentSubscriptionId string `json:"deploymentSubscriptionId"`
+			DeploymentWorkspace      string `json:"deploymentWorkspace"`
+		}{}
+		if err := json.Unmarshal(deployment, &key); err != nil {
+			continue
+		}
 
-				return deployment, err
-			}
+		if key.DeploymentWorkspace == workspace &&
+			key.DeploymentUserId == userId &&
+			key.DeploymentSubscriptionId == subscriptionId {
 
-			err = d.rdb.Set(ctx, userId+"-"+subscriptionId+"-"+workspace, marshalledDeployment, 0).Err()
+			// save deployment to redis
+			err = d.rdb.Set(ctx, userId+"-"+subscriptionId+"-"+workspace, string(deployment), 0).Err()
 			if err != nil {
 				slog.Debug("error occurred saving the deployment record to redis.",
 					slog.String("userId", userId),
@@ -184,11 +180,11 @@ func (d *deploymentRepository) GetDeployment(userId string, workspace string, su
 				)
 			}
 
-			return deployment, nil
+			return string(deployment), nil
 		}
 	}
 
-	return entity.Deployment{}, errors.New("deployment not found")
+	return "", errors.New("deployment not found")
 }
 
 func (d *deploymentRepository) UpsertDeployment(deployment entity.Deployment) error {
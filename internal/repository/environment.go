@@ -1,14 +1,203 @@
 package repository
 
 import (
+	"bytes"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"strings"
 
-	"golang.org/x/exp/slog"
+	"one-click-aks-server/internal/config"
+	"one-click-aks-server/internal/entity"
+	"one-click-aks-server/internal/helper"
 )
 
-func setEnvironmentVariable(key string, value string) {
-	err := os.Setenv(key, value)
+// Environment for commands that run terraform or scripts. It is built per command
+// and server's own environment is never modified. TF_VAR_* of server's environment are
+// dropped so that only variables passed in extra reach terraform.
+// Later entries win, so extra can override anything.
+func commandEnvironment(appConfig *config.Config, extra ...string) []string {
+	env := []string{}
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, "TF_VAR_") {
+			continue
+		}
+		env = append(env, kv)
+	}
+
+	env = append(env,
+		"terraform_directory=tf",
+		"root_directory="+os.ExpandEnv("$ROOT_DIR"),
+		"subscription_id="+appConfig.ActLabsHubSubscriptionID,
+		"resource_group_name="+appConfig.ActLabsHubResourceGroupName,
+		"storage_account_name="+appConfig.ActLabsHubStorageAccountName,
+		"container_name=repro-project-tf-state-files",
+		"tf_state_file_name="+appConfig.UserAlias+"-terraform.tfstate",
+	)
+
+	if appConfig.UseServicePrincipal {
+		env = append(env,
+			"ARM_CLIENT_ID="+appConfig.AzureClientID,
+			"ARM_CLIENT_SECRET="+appConfig.AzureClientSecret,
+			"ARM_SUBSCRIPTION_ID="+appConfig.SubscriptionID,
+			"ARM_TENANT_ID="+appConfig.AzureTenantID,
+		)
+	}
+
+	return append(env, extra...)
+}
+
+// Each workspace gets its own terraform data directory and its own copy of tf directory, and workspace
+// is selected for the command only, so that operations on different workspaces can run in parallel
+// without sharing .terraform.lock.hcl. Without workspace, command runs in tf directory against the
+// shared data directory and whichever workspace is selected there.
+func workspaceEnvironment(workspace string) ([]string, error) {
+	if workspace == "" {
+		return nil, nil
+	}
+
+	dataDir, err := workspaceDataDir(workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syncWorkspaceTerraformDir(workspace); err != nil {
+		return nil, err
+	}
+
+	workspaceDir, err := workspaceTerraformDir(workspace)
 	if err != nil {
-		slog.Error("not able to set environment variable", err)
+		return nil, err
+	}
+	terraformDir, err := filepath.Rel(os.ExpandEnv("$ROOT_DIR"), workspaceDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{
+		"TF_DATA_DIR=" + dataDir,
+		"TF_WORKSPACE=" + workspace,
+		"terraform_directory=" + terraformDir,
+	}, nil
+}
+
+func workspaceDataDir(workspace string) (string, error) {
+	return workspaceDir(filepath.Join(os.ExpandEnv("$ROOT_DIR"), "tf-data"), workspace)
+}
+
+// Directory terraform runs in for the workspace.
+func workspaceTerraformDir(workspace string) (string, error) {
+	if workspace == "" {
+		return filepath.Join(os.ExpandEnv("$ROOT_DIR"), "tf"), nil
+	}
+	return workspaceDir(filepath.Join(os.ExpandEnv("$ROOT_DIR"), "tf-workspaces"), workspace)
+}
+
+// Directory of the workspace in base directory. Workspace name comes from requests, so names that
+// aren't terraform workspace names or would resolve to anything but a directory right in base are refused.
+func workspaceDir(base string, workspace string) (string, error) {
+	dir := filepath.Join(base, workspace)
+	if !helper.ValidWorkspaceName(workspace) || filepath.Dir(dir) != filepath.Clean(base) {
+		return "", entity.ErrInvalidWorkspaceName
+	}
+	return dir, nil
+}
+
+// Brings copy of tf directory of the workspace up to date with tf directory. Files terraform
+// creates in it, like the lock file, are kept. Unchanged files are not written, and changed ones
+// are replaced by rename, so commands that read the copy at the same time see whole files.
+func syncWorkspaceTerraformDir(workspace string) error {
+	source := filepath.Join(os.ExpandEnv("$ROOT_DIR"), "tf")
+	target, err := workspaceDir(filepath.Join(os.ExpandEnv("$ROOT_DIR"), "tf-workspaces"), workspace)
+	if err != nil {
+		return err
+	}
+
+	copied := map[string]bool{}
+	err = filepath.WalkDir(source, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if generatedTerraformFile(entry.Name()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return os.MkdirAll(filepath.Join(target, rel), 0755)
+		}
+
+		copied[rel] = true
+		return copyFileIfChanged(path, filepath.Join(target, rel))
+	})
+	if err != nil {
+		return err
+	}
+
+	// files removed from tf directory are removed from the copy.
+	return filepath.WalkDir(target, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if generatedTerraformFile(entry.Name()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(target, path)
+		if err != nil || entry.IsDir() || copied[rel] {
+			return err
+		}
+		return os.Remove(path)
+	})
+}
+
+// files terraform and scripts create in the directory they run in.
+func generatedTerraformFile(name string) bool {
+	return strings.HasPrefix(name, ".terraform") ||
+		strings.HasPrefix(name, "terraform.tfstate") ||
+		strings.HasSuffix(name, ".log")
+}
+
+func copyFileIfChanged(source string, target string) error {
+	content, err := os.ReadFile(source)
+	if err != nil {
+		return err
+	}
+
+	if existing, err := os.ReadFile(target); err == nil && bytes.Equal(existing, content) {
+		return nil
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(target), ".terraform-sync-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(content); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), target)
+}
+
+// Terraform variables of the lab template as TF_VAR_* entries.
+func tfvarEnvironment(tfvar entity.TfvarConfigType) []string {
+	env := []string{}
+	for _, variable := range helper.TfvarVariables(tfvar) {
+		env = append(env, "TF_VAR_"+variable.Name+"="+variable.Value)
 	}
+	return env
 }
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"one-click-aks-server/internal/entity"
+)
+
+func writeTestFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestSyncWorkspaceTerraformDir(t *testing.T) {
+	rootDir := t.TempDir()
+	t.Setenv("ROOT_DIR", rootDir)
+
+	source := filepath.Join(rootDir, "tf")
+	writeTestFile(t, filepath.Join(source, "main.tf"), "v1")
+	writeTestFile(t, filepath.Join(source, "old.tf"), "old")
+	writeTestFile(t, filepath.Join(source, "modules", "aks", "main.tf"), "aks")
+	// shared directory's own terraform files are never copied.
+	writeTestFile(t, filepath.Join(source, ".terraform.lock.hcl"), "shared lock")
+	writeTestFile(t, filepath.Join(source, ".terraform", "environment"), "default")
+
+	for _, workspace := range []string{"lab1", "lab2"} {
+		if err := syncWorkspaceTerraformDir(workspace); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lab1, _ := workspaceTerraformDir("lab1")
+	lab2, _ := workspaceTerraformDir("lab2")
+	if got := readTestFile(t, filepath.Join(lab1, "modules", "aks", "main.tf")); got != "aks" {
+		t.Errorf("module got %q, want %q", got, "aks")
+	}
+	for _, path := range []string{".terraform.lock.hcl", ".terraform"} {
+		if _, err := os.Stat(filepath.Join(lab1, path)); !os.IsNotExist(err) {
+			t.Errorf("%s of tf directory is copied", path)
+		}
+	}
+
+	// init of lab1 creates its own lock file.
+	writeTestFile(t, filepath.Join(lab1, ".terraform.lock.hcl"), "lab1 lock")
+
+	writeTestFile(t, filepath.Join(source, "main.tf"), "v2")
+	if err := os.Remove(filepath.Join(source, "old.tf")); err != nil {
+		t.Fatal(err)
+	}
+	if err := syncWorkspaceTerraformDir("lab1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readTestFile(t, filepath.Join(lab1, "main.tf")); got != "v2" {
+		t.Errorf("main.tf got %q, want %q", got, "v2")
+	}
+	if _, err := os.Stat(filepath.Join(lab1, "old.tf")); !os.IsNotExist(err) {
+		t.Errorf("old.tf removed from tf directory is still in copy")
+	}
+	if got := readTestFile(t, filepath.Join(lab1, ".terraform.lock.hcl")); got != "lab1 lock" {
+		t.Errorf("lock file got %q, want %q", got, "lab1 lock")
+	}
+	if _, err := os.Stat(filepath.Join(lab2, ".terraform.lock.hcl")); !os.IsNotExist(err) {
+		t.Errorf("lock file of lab1 is shared with lab2")
+	}
+	if got := readTestFile(t, filepath.Join(lab2, "main.tf")); got != "v1" {
+		t.Errorf("lab2 is synced with lab1, main.tf got %q", got)
+	}
+}
+
+func TestWorkspaceEnvironmentRefusesPathsOutsideWorkspaces(t *testing.T) {
+	rootDir := t.TempDir()
+	t.Setenv("ROOT_DIR", rootDir)
+
+	writeTestFile(t, filepath.Join(rootDir, "tf", "main.tf"), "main")
+	writeTestFile(t, filepath.Join(rootDir, "scripts", "terraform.sh"), "script")
+	writeTestFile(t, filepath.Join(rootDir, ".env"), "env")
+
+	for _, workspace := range []string{"..", ".", "../tf", "a/b", "a\\b", "../../etc", "lab 1", "lab.1"} {
+		t.Run(workspace, func(t *testing.T) {
+			if _, err := workspaceEnvironment(workspace); !errors.Is(err, entity.ErrInvalidWorkspaceName) {
+				t.Errorf("workspaceEnvironment err got %v, want %v", err, entity.ErrInvalidWorkspaceName)
+			}
+			if _, err := workspaceDataDir(workspace); !errors.Is(err, entity.ErrInvalidWorkspaceName) {
+				t.Errorf("workspaceDataDir err got %v, want %v", err, entity.ErrInvalidWorkspaceName)
+			}
+			if err := syncWorkspaceTerraformDir(workspace); !errors.Is(err, entity.ErrInvalidWorkspaceName) {
+				t.Errorf("syncWorkspaceTerraformDir err got %v, want %v", err, entity.ErrInvalidWorkspaceName)
+			}
+		})
+	}
+
+	for path, want := range map[string]string{"tf/main.tf": "main", "scripts/terraform.sh": "script", ".env": "env"} {
+		if got := readTestFile(t, filepath.Join(rootDir, path)); got != want {
+			t.Errorf("%s got %q, want %q", path, got, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(rootDir, "tf-workspaces")); !os.IsNotExist(err) {
+		t.Errorf("tf-workspaces created for invalid workspace names")
+	}
+}
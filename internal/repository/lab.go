@@ -62,7 +62,9 @@ func (l *labRepository) GetProtectedLab(typeOfLab string, labId string) (string,
 
 	armAccessToken, err := l.auth.GetARMAccessToken()
 	if err != nil {
-		slog.Error("error getting arm access token ", err)
+		slog.Error("error getting arm access token",
+			slog.String("error", err.Error()),
+		)
 		return "", err
 	}
 
@@ -3,55 +3,165 @@ package repository
 import (
 	"context"
 
+	"one-click-aks-server/internal/config"
 	"one-click-aks-server/internal/entity"
 
 	"github.com/redis/go-redis/v9"
 )
 
-type logStreamRepository struct{}
+type logStreamRepository struct {
+	appConfig *config.Config
+	rdb       *redis.Client
+}
 
-func NewLogStreamRepository() entity.LogStreamRepository {
-	return &logStreamRepository{}
+func NewLogStreamRepository(appConfig *config.Config, rdb *redis.Client) entity.LogStreamRepository {
+	return &logStreamRepository{
+		appConfig: appConfig,
+		rdb:       rdb,
+	}
 }
 
 var logStreamCtx = context.Background()
 
-func newLogStreamRedisClient() *redis.Client {
-	return redis.NewClient(&redis.Options{
-		Addr:     "localhost:6379",
-		Password: "", // no password set
-		DB:       0,  // use default DB
-	})
+const (
+	// list of operation ids with log streams, latest first.
+	logStreamOperationsKey = "log-stream-operations"
+
+	// list of background operation ids with log streams, latest first.
+	logStreamBackgroundOperationsKey = "log-stream-background-operations"
+
+	latestLogStreamChannel = "redis-log-stream-pubsub-channel"
+)
+
+// Each log stream is a list of lines, the sequence number of a line is its position in the list.
+// Logs written before any operation was started go to 'log-lines'.
+func logStreamKey(operationId string) string {
+	if operationId == "" {
+		return "log-lines"
+	}
+	return "log-lines-" + operationId
+}
+
+func logStreamChannel(operationId string) string {
+	return latestLogStreamChannel + "-" + operationId
+}
+
+func (l *logStreamRepository) AppendLogLine(operationId string, line string) (int64, error) {
+	return l.rdb.RPush(logStreamCtx, logStreamKey(operationId), line).Result()
+}
+
+func (l *logStreamRepository) GetLogLines(operationId string, fromSeq int64) ([]string, error) {
+	if fromSeq < 1 {
+		fromSeq = 1
+	}
+	return l.rdb.LRange(logStreamCtx, logStreamKey(operationId), fromSeq-1, -1).Result()
+}
+
+func (l *logStreamRepository) GetLogLinesCount(operationId string) (int64, error) {
+	return l.rdb.LLen(logStreamCtx, logStreamKey(operationId)).Result()
+}
+
+func (l *logStreamRepository) DeleteLogLines(operationId string) error {
+	return l.rdb.Del(logStreamCtx, logStreamKey(operationId)).Err()
 }
 
-func (l *logStreamRepository) SetLogsInRedis(logStream string) error {
-	rdb := newLogStreamRedisClient()
-	if err := rdb.Set(logStreamCtx, "logs", logStream, 0).Err(); err != nil {
+func (l *logStreamRepository) PublishLogLine(operationId string, val string) error {
+	if err := l.rdb.Publish(logStreamCtx, logStreamChannel(operationId), val).Err(); err != nil {
 		return err
 	}
 
-	if err := rdb.Publish(logStreamCtx, "redis-log-stream-pubsub-channel", logStream).Err(); err != nil {
+	// Clients following the latest operation get the line too.
+	latestOperationId, err := l.GetLatestOperationId()
+	if err != nil {
 		return err
 	}
 
+	if latestOperationId == operationId {
+		return l.rdb.Publish(logStreamCtx, latestLogStreamChannel, val).Err()
+	}
+
 	return nil
 }
 
-func (l *logStreamRepository) GetLogsFromRedis() (string, error) {
-	rdb := newLogStreamRedisClient()
-	return rdb.Get(logStreamCtx, "logs").Result()
+func (l *logStreamRepository) SubscribeToLogs(operationId string) (<-chan string, func(), error) {
+	return l.subscribeToLogStream(logStreamChannel(operationId))
+}
+
+func (l *logStreamRepository) SubscribeToLatestLogs() (<-chan string, func(), error) {
+	return l.subscribeToLogStream(latestLogStreamChannel)
 }
 
-func (l *logStreamRepository) WaitForLogsChange() (string, error) {
-	rdb := newLogStreamRedisClient().Subscribe(logStreamCtx, "redis-log-stream-pubsub-channel")
-	defer rdb.Close()
+func (l *logStreamRepository) SetLatestOperationId(operationId string) error {
+	return l.addToHistory(logStreamOperationsKey, operationId)
+}
 
-	for {
-		msg, err := rdb.ReceiveMessage(logStreamCtx)
-		if err != nil {
-			return "", err
+func (l *logStreamRepository) AddBackgroundOperationId(operationId string) error {
+	return l.addToHistory(logStreamBackgroundOperationsKey, operationId)
+}
+
+// Adds operation at the start of history list and removes
+// log streams beyond history limit.
+func (l *logStreamRepository) addToHistory(key string, operationId string) error {
+	if err := l.rdb.LRem(logStreamCtx, key, 0, operationId).Err(); err != nil {
+		return err
+	}
+
+	if err := l.rdb.LPush(logStreamCtx, key, operationId).Err(); err != nil {
+		return err
+	}
+
+	limit := int64(l.appConfig.LogStreamHistoryLimit)
+	if limit <= 0 {
+		return nil
+	}
+
+	staleOperationIds, err := l.rdb.LRange(logStreamCtx, key, limit, -1).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, staleOperationId := range staleOperationIds {
+		if err := l.DeleteLogLines(staleOperationId); err != nil {
+			return err
 		}
+	}
+
+	return l.rdb.LTrim(logStreamCtx, key, 0, limit-1).Err()
+}
 
-		return msg.Payload, nil
+func (l *logStreamRepository) GetLatestOperationId() (string, error) {
+	operationId, err := l.rdb.LIndex(logStreamCtx, logStreamOperationsKey, 0).Result()
+	if err == redis.Nil {
+		return "", nil
 	}
+
+	return operationId, err
+}
+
+func (l *logStreamRepository) subscribeToLogStream(channel string) (<-chan string, func(), error) {
+	pubsub := l.rdb.Subscribe(logStreamCtx, channel)
+
+	// Wait for confirmation that subscription is created.
+	if _, err := pubsub.Receive(logStreamCtx); err != nil {
+		pubsub.Close()
+		return nil, nil, err
+	}
+
+	messages := make(chan string)
+	done := make(chan struct{})
+	go func() {
+		defer close(messages)
+		for msg := range pubsub.Channel() {
+			select {
+			case messages <- msg.Payload:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return messages, func() {
+		close(done)
+		pubsub.Close()
+	}, nil
 }
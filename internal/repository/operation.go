@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"one-click-aks-server/internal/config"
+	"one-click-aks-server/internal/entity"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type operationRepository struct {
+	appConfig *config.Config
+	rdb       *redis.Client
+}
+
+func NewOperationRepository(appConfig *config.Config, rdb *redis.Client) entity.OperationRepository {
+	return &operationRepository{
+		appConfig: appConfig,
+		rdb:       rdb,
+	}
+}
+
+// list of operation ids, latest first.
+const operationsKey = "operations"
+
+func operationKey(operationId string) string {
+	return "operation-" + operationId
+}
+
+func (o *operationRepository) GetOperations() ([]string, error) {
+	operationIds, err := o.rdb.LRange(ctx, operationsKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(operationIds) == 0 {
+		return []string{}, nil
+	}
+
+	keys := []string{}
+	for _, operationId := range operationIds {
+		keys = append(keys, operationKey(operationId))
+	}
+
+	vals, err := o.rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	operations := []string{}
+	for _, val := range vals {
+		// record may have been removed while trimming history.
+		if s, ok := val.(string); ok {
+			operations = append(operations, s)
+		}
+	}
+
+	return operations, nil
+}
+
+func (o *operationRepository) GetOperation(operationId string) (string, error) {
+	return o.rdb.Get(ctx, operationKey(operationId)).Result()
+}
+
+func (o *operationRepository) AddOperation(operationId string, val string) error {
+	if err := o.rdb.Set(ctx, operationKey(operationId), val, 0).Err(); err != nil {
+		return err
+	}
+
+	// Operation id may be reused by the client, keep only one entry in history.
+	if err := o.rdb.LRem(ctx, operationsKey, 0, operationId).Err(); err != nil {
+		return err
+	}
+
+	if err := o.rdb.LPush(ctx, operationsKey, operationId).Err(); err != nil {
+		return err
+	}
+
+	return o.trimOperations()
+}
+
+func (o *operationRepository) SetOperation(operationId string, val string) error {
+	return o.rdb.Set(ctx, operationKey(operationId), val, 0).Err()
+}
+
+// removes operations older than the configured history limit.
+func (o *operationRepository) trimOperations() error {
+	limit := int64(o.appConfig.OperationHistoryLimit)
+	if limit <= 0 {
+		return nil
+	}
+
+	staleOperationIds, err := o.rdb.LRange(ctx, operationsKey, limit, -1).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, operationId := range staleOperationIds {
+		if err := o.rdb.Del(ctx, operationKey(operationId)).Err(); err != nil {
+			return err
+		}
+	}
+
+	return o.rdb.LTrim(ctx, operationsKey, 0, limit-1).Err()
+}
@@ -2,8 +2,12 @@ package repository
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io"
 	"strings"
+	"time"
 
 	"one-click-aks-server/internal/auth"
 	"one-click-aks-server/internal/config"
@@ -12,11 +16,22 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/lease"
 	"github.com/redis/go-redis/v9"
 	"golang.org/x/exp/slog"
 )
 
+const (
+	tfLockInfoMetadataKey = "terraformlockid"
+	leaseBreakAuditKey    = "lease-break-audit"
+	leaseBreakAuditLimit  = 100
+
+	snapshotActionMetadataKey      = "action"
+	snapshotOperationIdMetadataKey = "operationid"
+	snapshotCopyMaxPolls           = 60
+)
+
 type storageAccountRepository struct {
 	auth   *auth.Auth
 	rdb    *redis.Client
@@ -105,7 +120,239 @@ func (s *storageAccountRepository) BreakBlobLease(storageAccountName string, con
 	return nil
 }
 
-func (s *storageAccountRepository) createLeaseBlobClient(storageAccountName string, accountKey string, containerName string, blobName string) (*lease.BlobClient, error) {
+// https://pkg.go.dev/github.com/Azure/azure-sdk-for-go/sdk/storage/azblob@v1.2.0/blob#Client.GetProperties
+func (s *storageAccountRepository) GetBlobLease(storageAccountName string, containerName string, blobName string) (entity.BlobLease, error) {
+	slog.Debug("getting blob lease for blob", blobName+" in container "+containerName+" in storage account "+storageAccountName)
+
+	// Append user alias to blob name
+	blobName = s.config.UserAlias + "-" + blobName
+
+	accountKey, err := s.auth.GetStorageAccountKey(s.config.ActLabsHubSubscriptionID, s.config.ActLabsHubResourceGroupName, storageAccountName)
+	if err != nil {
+		return entity.BlobLease{}, fmt.Errorf("failed to get storage account key: %w", err)
+	}
+
+	blobClient, err := s.createBlobClient(storageAccountName, accountKey, containerName, blobName)
+	if err != nil {
+		return entity.BlobLease{}, fmt.Errorf("not able to create blob client: %w", err)
+	}
+
+	properties, err := blobClient.GetProperties(context.Background(), nil)
+	if err != nil {
+		return entity.BlobLease{}, fmt.Errorf("failed to get blob properties: %w", err)
+	}
+
+	blobLease := entity.BlobLease{
+		BlobName: blobName,
+	}
+	if properties.LeaseState != nil {
+		blobLease.LeaseState = string(*properties.LeaseState)
+		blobLease.Leased = *properties.LeaseState == lease.StateTypeLeased
+	}
+	if properties.LeaseStatus != nil {
+		blobLease.LeaseStatus = string(*properties.LeaseStatus)
+	}
+	if properties.LeaseDuration != nil {
+		blobLease.LeaseDuration = string(*properties.LeaseDuration)
+	}
+	if properties.LastModified != nil {
+		blobLease.LastModified = properties.LastModified.Unix()
+	}
+	if properties.ContentLength != nil {
+		blobLease.Size = *properties.ContentLength
+	}
+
+	if lockInfo := helperMetadataValue(properties.Metadata, tfLockInfoMetadataKey); lockInfo != "" {
+		if err := helperParseTfLockInfo(lockInfo, &blobLease); err != nil {
+			slog.Debug("not able to parse terraform lock info of blob " + blobName + ": " + err.Error())
+		}
+	}
+
+	return blobLease, nil
+}
+
+// https://pkg.go.dev/github.com/Azure/azure-sdk-for-go/sdk/storage/azblob@v1.2.0/blob#Client.DownloadStream
+func (s *storageAccountRepository) GetBlob(storageAccountName string, containerName string, blobName string) (string, error) {
+	// Append user alias to blob name
+	blobName = s.config.UserAlias + "-" + blobName
+
+	accountKey, err := s.auth.GetStorageAccountKey(s.config.ActLabsHubSubscriptionID, s.config.ActLabsHubResourceGroupName, storageAccountName)
+	if err != nil {
+		return "", fmt.Errorf("failed to get storage account key: %w", err)
+	}
+
+	blobClient, err := s.createBlobClient(storageAccountName, accountKey, containerName, blobName)
+	if err != nil {
+		return "", fmt.Errorf("not able to create blob client: %w", err)
+	}
+
+	resp, err := blobClient.DownloadStream(context.Background(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to download blob: %w", err)
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read blob: %w", err)
+	}
+
+	return string(content), nil
+}
+
+func (s *storageAccountRepository) AddLeaseBreakAudit(val string) error {
+	if err := s.rdb.LPush(context.Background(), leaseBreakAuditKey, val).Err(); err != nil {
+		return err
+	}
+	return s.rdb.LTrim(context.Background(), leaseBreakAuditKey, 0, leaseBreakAuditLimit-1).Err()
+}
+
+func (s *storageAccountRepository) GetLeaseBreakAudits() ([]string, error) {
+	return s.rdb.LRange(context.Background(), leaseBreakAuditKey, 0, -1).Result()
+}
+
+// https://pkg.go.dev/github.com/Azure/azure-sdk-for-go/sdk/storage/azblob@v1.2.0/blob#Client.CreateSnapshot
+func (s *storageAccountRepository) CreateBlobSnapshot(storageAccountName string, containerName string, blobName string, action string, operationId string) (string, error) {
+	slog.Debug("creating snapshot of blob", blobName+" in container "+containerName+" in storage account "+storageAccountName)
+
+	// Append user alias to blob name
+	blobName = s.config.UserAlias + "-" + blobName
+
+	accountKey, err := s.auth.GetStorageAccountKey(s.config.ActLabsHubSubscriptionID, s.config.ActLabsHubResourceGroupName, storageAccountName)
+	if err != nil {
+		return "", fmt.Errorf("failed to get storage account key: %w", err)
+	}
+
+	blobClient, err := s.createBlobClient(storageAccountName, accountKey, containerName, blobName)
+	if err != nil {
+		return "", fmt.Errorf("not able to create blob client: %w", err)
+	}
+
+	resp, err := blobClient.CreateSnapshot(context.Background(), &blob.CreateSnapshotOptions{
+		Metadata: map[string]*string{
+			snapshotActionMetadataKey:      to.Ptr(action),
+			snapshotOperationIdMetadataKey: to.Ptr(operationId),
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create blob snapshot: %w", err)
+	}
+	if resp.Snapshot == nil {
+		return "", fmt.Errorf("no snapshot id in response")
+	}
+
+	return *resp.Snapshot, nil
+}
+
+// https://pkg.go.dev/github.com/Azure/azure-sdk-for-go/sdk/storage/azblob@v1.2.0/container#Client.NewListBlobsFlatPager
+func (s *storageAccountRepository) ListBlobSnapshots(storageAccountName string, containerName string, blobName string) ([]entity.StateSnapshot, error) {
+	slog.Debug("listing snapshots of blob", blobName+" in container "+containerName+" in storage account "+storageAccountName)
+
+	// Append user alias to blob name
+	blobName = s.config.UserAlias + "-" + blobName
+
+	accountKey, err := s.auth.GetStorageAccountKey(s.config.ActLabsHubSubscriptionID, s.config.ActLabsHubResourceGroupName, storageAccountName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get storage account key: %w", err)
+	}
+
+	containerClient, err := newContainerClient(storageAccountName, accountKey, containerName)
+	if err != nil {
+		return nil, fmt.Errorf("not able to create container client: %w", err)
+	}
+
+	snapshots := []entity.StateSnapshot{}
+
+	pager := containerClient.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{
+		Prefix:  to.Ptr(blobName),
+		Include: container.ListBlobsInclude{Snapshots: true, Metadata: true},
+	})
+	for pager.More() {
+		page, err := pager.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list blobs: %w", err)
+		}
+
+		for _, item := range page.Segment.BlobItems {
+			// prefix matches state of other workspaces too, and the base blob itself.
+			if item.Name == nil || *item.Name != blobName || item.Snapshot == nil || *item.Snapshot == "" {
+				continue
+			}
+
+			snapshot := entity.StateSnapshot{
+				SnapshotId:  *item.Snapshot,
+				Action:      helperMetadataValue(item.Metadata, snapshotActionMetadataKey),
+				OperationId: helperMetadataValue(item.Metadata, snapshotOperationIdMetadataKey),
+			}
+			if createdAt, err := time.Parse(time.RFC3339Nano, *item.Snapshot); err == nil {
+				snapshot.CreatedAt = createdAt.Unix()
+			}
+			if item.Properties != nil && item.Properties.ContentLength != nil {
+				snapshot.Size = *item.Properties.ContentLength
+			}
+
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+
+	return snapshots, nil
+}
+
+// https://pkg.go.dev/github.com/Azure/azure-sdk-for-go/sdk/storage/azblob@v1.2.0/blob#Client.StartCopyFromURL
+func (s *storageAccountRepository) RestoreBlobSnapshot(storageAccountName string, containerName string, blobName string, snapshotId string) error {
+	slog.Debug("restoring snapshot "+snapshotId+" of blob", blobName+" in container "+containerName+" in storage account "+storageAccountName)
+
+	// Append user alias to blob name
+	blobName = s.config.UserAlias + "-" + blobName
+
+	accountKey, err := s.auth.GetStorageAccountKey(s.config.ActLabsHubSubscriptionID, s.config.ActLabsHubResourceGroupName, storageAccountName)
+	if err != nil {
+		return fmt.Errorf("failed to get storage account key: %w", err)
+	}
+
+	blobClient, err := s.createBlobClient(storageAccountName, accountKey, containerName, blobName)
+	if err != nil {
+		return fmt.Errorf("not able to create blob client: %w", err)
+	}
+
+	snapshotClient, err := blobClient.WithSnapshot(snapshotId)
+	if err != nil {
+		return fmt.Errorf("not able to create snapshot client: %w", err)
+	}
+
+	// fails with 404 if there is no such snapshot.
+	if _, err := snapshotClient.GetProperties(context.Background(), nil); err != nil {
+		return fmt.Errorf("failed to get snapshot properties: %w", err)
+	}
+
+	// source in same storage account is authorized with shared key of the request.
+	resp, err := blobClient.StartCopyFromURL(context.Background(), snapshotClient.URL(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to copy snapshot: %w", err)
+	}
+
+	copyStatus := resp.CopyStatus
+	for i := 0; copyStatus != nil && *copyStatus == blob.CopyStatusTypePending; i++ {
+		if i == snapshotCopyMaxPolls {
+			return fmt.Errorf("copy of snapshot did not finish in time")
+		}
+		time.Sleep(time.Second)
+
+		properties, err := blobClient.GetProperties(context.Background(), nil)
+		if err != nil {
+			return fmt.Errorf("failed to get blob properties: %w", err)
+		}
+		copyStatus = properties.CopyStatus
+	}
+
+	if copyStatus != nil && *copyStatus != blob.CopyStatusTypeSuccess {
+		return fmt.Errorf("copy of snapshot ended with status %s", *copyStatus)
+	}
+
+	return nil
+}
+
+func (s *storageAccountRepository) createBlobClient(storageAccountName string, accountKey string, containerName string, blobName string) (*blob.Client, error) {
 	cred, err := azblob.NewSharedKeyCredential(storageAccountName, accountKey)
 	if err != nil {
 		return nil, err
@@ -113,7 +360,22 @@ func (s *storageAccountRepository) createLeaseBlobClient(storageAccountName stri
 
 	url := fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s", storageAccountName, containerName, blobName)
 
-	blobClient, err := blob.NewClientWithSharedKeyCredential(url, cred, nil)
+	return blob.NewClientWithSharedKeyCredential(url, cred, nil)
+}
+
+func newContainerClient(storageAccountName string, accountKey string, containerName string) (*container.Client, error) {
+	cred, err := azblob.NewSharedKeyCredential(storageAccountName, accountKey)
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("https://%s.blob.core.windows.net/%s", storageAccountName, containerName)
+
+	return container.NewClientWithSharedKeyCredential(url, cred, nil)
+}
+
+func (s *storageAccountRepository) createLeaseBlobClient(storageAccountName string, accountKey string, containerName string, blobName string) (*lease.BlobClient, error) {
+	blobClient, err := s.createBlobClient(storageAccountName, accountKey, containerName, blobName)
 	if err != nil {
 		return nil, err
 	}
@@ -126,6 +388,42 @@ func (s *storageAccountRepository) createLeaseBlobClient(storageAccountName stri
 	return leaseBlobClient, nil
 }
 
+// metadata keys come back in canonical header case from some APIs.
+func helperMetadataValue(metadata map[string]*string, key string) string {
+	for k, val := range metadata {
+		if strings.EqualFold(k, key) && val != nil {
+			return *val
+		}
+	}
+	return ""
+}
+
+// azurerm backend of terraform keeps base64 encoded lock info in this metadata of the state blob.
+func helperParseTfLockInfo(val string, blobLease *entity.BlobLease) error {
+	decoded, err := base64.StdEncoding.DecodeString(val)
+	if err != nil {
+		return err
+	}
+
+	lockInfo := struct {
+		ID        string    `json:"ID"`
+		Operation string    `json:"Operation"`
+		Who       string    `json:"Who"`
+		Created   time.Time `json:"Created"`
+	}{}
+	if err := json.Unmarshal(decoded, &lockInfo); err != nil {
+		return err
+	}
+
+	blobLease.LockId = lockInfo.ID
+	blobLease.LockOperation = lockInfo.Operation
+	blobLease.LockWho = lockInfo.Who
+	if !lockInfo.Created.IsZero() {
+		blobLease.LockCreated = lockInfo.Created.Unix()
+	}
+	return nil
+}
+
 func UserAliasForStorageAccount(userPrincipalName string) string {
 	// change to lowercase
 	userPrincipalName = strings.ToLower(userPrincipalName)
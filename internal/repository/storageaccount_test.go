@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"one-click-aks-server/internal/entity"
+)
+
+func TestHelperParseTfLockInfo(t *testing.T) {
+	encode := func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	}
+
+	tests := []struct {
+		name    string
+		val     string
+		want    entity.BlobLease
+		wantErr bool
+	}{
+		{
+			name: "lock info",
+			val:  encode(`{"ID":"8a2b1c3d-0000-4000-8000-000000000000","Operation":"OperationTypeApply","Info":"","Who":"user@host","Version":"1.6.6","Created":"2024-01-02T03:04:05.123456Z","Path":"tfstate/terraform.tfstateenv:ws"}`),
+			want: entity.BlobLease{
+				LockId:        "8a2b1c3d-0000-4000-8000-000000000000",
+				LockOperation: "OperationTypeApply",
+				LockWho:       "user@host",
+				LockCreated:   1704164645,
+			},
+		},
+		{
+			name: "created missing",
+			val:  encode(`{"ID":"id","Operation":"OperationTypePlan","Who":"user@host"}`),
+			want: entity.BlobLease{LockId: "id", LockOperation: "OperationTypePlan", LockWho: "user@host"},
+		},
+		{
+			name:    "not base64",
+			val:     "not base64!",
+			wantErr: true,
+		},
+		{
+			name:    "not json",
+			val:     encode("lock"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blobLease := entity.BlobLease{}
+			err := helperParseTfLockInfo(tt.val, &blobLease)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err got %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && blobLease != tt.want {
+				t.Errorf("got %+v, want %+v", blobLease, tt.want)
+			}
+		})
+	}
+}
@@ -1,20 +1,15 @@
 package repository
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"os/exec"
-	"reflect"
+	"syscall"
 
 	"one-click-aks-server/internal/config"
 	"one-click-aks-server/internal/entity"
-	"one-click-aks-server/internal/helper"
-
-	"github.com/Rican7/conjson"
-	"github.com/Rican7/conjson/transform"
-	"golang.org/x/exp/slog"
 )
 
 type terraformRepository struct {
@@ -27,44 +22,16 @@ func NewTerraformRepository(appConfig *config.Config) entity.TerraformRepository
 	}
 }
 
-func (t *terraformRepository) TerraformAction(tfvar entity.TfvarConfigType, action string, storageAccountName string) (*exec.Cmd, *os.File, *os.File, error) {
-
-	setEnvironmentVariable("terraform_directory", "tf")
-	setEnvironmentVariable("root_directory", os.ExpandEnv("$ROOT_DIR"))
-	setEnvironmentVariable("subscription_id", t.appConfig.ActLabsHubSubscriptionID)
-	setEnvironmentVariable("resource_group_name", t.appConfig.ActLabsHubResourceGroupName)
-	setEnvironmentVariable("storage_account_name", t.appConfig.ActLabsHubStorageAccountName)
-	setEnvironmentVariable("container_name", "repro-project-tf-state-files")
-	setEnvironmentVariable("tf_state_file_name", t.appConfig.UserAlias+"-terraform.tfstate")
-	if t.appConfig.UseServicePrincipal {
-		setEnvironmentVariable("ARM_CLIENT_ID", t.appConfig.AzureClientID)
-		setEnvironmentVariable("ARM_CLIENT_SECRET", t.appConfig.AzureClientSecret)
-		setEnvironmentVariable("ARM_SUBSCRIPTION_ID", t.appConfig.SubscriptionID)
-		setEnvironmentVariable("ARM_TENANT_ID", t.appConfig.AzureTenantID)
-	}
-
-	// Sets terraform environment variables from tfvar
-
-	tr := reflect.TypeOf(tfvar)
-	// Loop over the fields in the struct.
-	for i := 0; i < tr.NumField(); i++ {
-		// Get the field and its value at the current index.
-		field := reflect.TypeOf(tfvar).Field(i)
-		value := reflect.ValueOf(tfvar).Field(i)
-
-		// Set the environment variable of resource.
-		encoded, _ := json.Marshal(conjson.NewMarshaler(value.Interface(), transform.ConventionalKeys()))
-
-		slog.Debug("Field :" + field.Name + " Encoded String : " + string(encoded))
-
-		// If a variable doesn't exist, just skip it and let terraform default do the magic.
-		if string(encoded) != "null" {
-			setEnvironmentVariable("TF_VAR_"+helper.CamelToConventional(field.Name), string(encoded))
-		}
-	}
-
+func (t *terraformRepository) TerraformAction(tfvar entity.TfvarConfigType, action string, storageAccountName string, workspace string, args ...string) (*exec.Cmd, *os.File, *os.File, error) {
 	// Execute terraform script with appropriate action.
-	cmd := exec.Command(os.ExpandEnv("$ROOT_DIR")+"/scripts/terraform.sh", action)
+	cmd := exec.Command(os.ExpandEnv("$ROOT_DIR")+"/scripts/terraform.sh", append([]string{action}, args...)...)
+	env, err := workspaceEnvironment(workspace)
+	if err != nil {
+		return cmd, nil, nil, err
+	}
+	cmd.Env = commandEnvironment(t.appConfig, append(env, tfvarEnvironment(tfvar)...)...)
+	// Own process group so that cancellation reaches terraform and not just the script.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 	rPipe, wPipe, err := os.Pipe()
 	if err != nil {
 		return cmd, rPipe, wPipe, err
@@ -79,24 +46,43 @@ func (t *terraformRepository) TerraformAction(tfvar entity.TfvarConfigType, acti
 	return cmd, rPipe, wPipe, nil
 }
 
-func (t *terraformRepository) ExecuteScript(script string, mode string, storageAccountName string) (*exec.Cmd, *os.File, *os.File, error) {
-	setEnvironmentVariable("terraform_directory", "tf")
-	setEnvironmentVariable("root_directory", os.ExpandEnv("$ROOT_DIR"))
-	setEnvironmentVariable("subscription_id", t.appConfig.ActLabsHubSubscriptionID)
-	setEnvironmentVariable("resource_group_name", t.appConfig.ActLabsHubResourceGroupName)
-	setEnvironmentVariable("storage_account_name", t.appConfig.ActLabsHubStorageAccountName)
-	setEnvironmentVariable("container_name", "repro-project-tf-state-files")
-	setEnvironmentVariable("tf_state_file_name", t.appConfig.UserAlias+"-terraform.tfstate")
-	setEnvironmentVariable("SCRIPT_MODE", mode)
-	if t.appConfig.UseServicePrincipal {
-		setEnvironmentVariable("ARM_CLIENT_ID", t.appConfig.AzureClientID)
-		setEnvironmentVariable("ARM_CLIENT_SECRET", t.appConfig.AzureClientSecret)
-		setEnvironmentVariable("ARM_SUBSCRIPTION_ID", t.appConfig.SubscriptionID)
-		setEnvironmentVariable("ARM_TENANT_ID", t.appConfig.AzureTenantID)
+func (t *terraformRepository) ShowPlan(planFile string, workspace string) ([]byte, error) {
+	env, err := workspaceEnvironment(workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	terraformDir, err := workspaceTerraformDir(workspace)
+	if err != nil {
+		return nil, err
 	}
 
+	cmd := exec.Command("terraform", "show", "-json", planFile)
+	cmd.Dir = terraformDir
+	cmd.Env = commandEnvironment(t.appConfig, env...)
+
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("terraform show failed: %s", string(exitErr.Stderr))
+		}
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (t *terraformRepository) ExecuteScript(script string, mode string, storageAccountName string, workspace string) (*exec.Cmd, *os.File, *os.File, error) {
 	// Execute terraform script with appropriate action.
 	cmd := exec.Command("bash", "-c", "echo '"+script+"' | base64 -d | dos2unix | bash")
+	env, err := workspaceEnvironment(workspace)
+	if err != nil {
+		return cmd, nil, nil, err
+	}
+	cmd.Env = commandEnvironment(t.appConfig, append(env, "SCRIPT_MODE="+mode)...)
+	// Own process group so that cancellation reaches every command the script runs.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 	rPipe, wPipe, err := os.Pipe()
 	if err != nil {
 		return cmd, rPipe, wPipe, err
@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"one-click-aks-server/internal/config"
+	"one-click-aks-server/internal/entity"
+)
+
+// Stub terraform records its arguments, one invocation per line, and exits
+// with $STUB_TERRAFORM_EXIT for the action under test.
+const stubTerraform = `#!/bin/bash
+echo "$*" >> "$STUB_TERRAFORM_ARGV"
+pwd > "$STUB_TERRAFORM_ARGV.pwd"
+if [[ "$1" != "init" ]]; then
+  exit ${STUB_TERRAFORM_EXIT:-0}
+fi
+`
+
+// Runs scripts/terraform.sh with stub terraform, az and jq on PATH and returns
+// arguments of the last terraform invocation, and error of the script.
+func runTerraformScript(t *testing.T, exitCode string, action string, args ...string) (string, error) {
+	t.Helper()
+	argv, _, err := runTerraformScriptInWorkspace(t, "", exitCode, action, args...)
+	return argv, err
+}
+
+// Same as runTerraformScript, and also returns directory terraform ran in.
+func runTerraformScriptInWorkspace(t *testing.T, workspace string, exitCode string, action string, args ...string) (string, string, error) {
+	t.Helper()
+
+	rootDir := t.TempDir()
+	binDir := filepath.Join(rootDir, "bin")
+	for _, dir := range []string{"scripts", "tf", "bin"} {
+		if err := os.MkdirAll(filepath.Join(rootDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, script := range []string{"terraform.sh", "helper.sh"} {
+		content, err := os.ReadFile(filepath.Join("..", "..", "scripts", script))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(rootDir, "scripts", script), content, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stubs := map[string]string{
+		"terraform": stubTerraform,
+		"az":        "#!/bin/bash\necho true\n",
+		"jq":        "#!/bin/bash\ncat\n",
+	}
+	for name, content := range stubs {
+		if err := os.WriteFile(filepath.Join(binDir, name), []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	argvFile := filepath.Join(rootDir, "argv")
+	t.Setenv("ROOT_DIR", rootDir)
+	t.Setenv("PATH", binDir+":"+os.Getenv("PATH"))
+	t.Setenv("STUB_TERRAFORM_ARGV", argvFile)
+	t.Setenv("STUB_TERRAFORM_EXIT", exitCode)
+	t.Setenv("ARM_SUBSCRIPTION_ID", "00000000-0000-0000-0000-000000000000")
+
+	if err := os.WriteFile(filepath.Join(rootDir, "tf", "main.tf"), []byte("# main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewTerraformRepository(&config.Config{})
+	cmd, rPipe, wPipe, err := repo.TerraformAction(entity.TfvarConfigType{}, action, "storageaccount", workspace, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go io.Copy(io.Discard, rPipe)
+	err = cmd.Wait()
+	wPipe.Close()
+
+	argv, readErr := os.ReadFile(argvFile)
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	dir, readErr := os.ReadFile(argvFile + ".pwd")
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	lines := strings.Split(strings.TrimSpace(string(argv)), "\n")
+	return lines[len(lines)-1], strings.TrimSpace(string(dir)), err
+}
+
+func TestTerraformScriptPassesArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		action string
+		args   []string
+		want   string
+	}{
+		{"plan saves plan file", "plan", []string{"-out=/plans/op.tfplan"}, "plan -out=/plans/op.tfplan"},
+		{"apply of saved plan", "apply", []string{"/plans/op.tfplan"}, "apply -auto-approve /plans/op.tfplan"},
+		{"targeted apply", "apply", []string{"-target=module.aks"}, "apply -auto-approve -target=module.aks"},
+		{"targeted destroy", "destroy", []string{"-target=module.aks", "-target=module.vnet"}, "destroy -auto-approve -target=module.aks -target=module.vnet"},
+		{"drift check", "plan", []string{"-detailed-exitcode", "-out=/plans/op.tfplan"}, "plan -detailed-exitcode -out=/plans/op.tfplan"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := runTerraformScript(t, "0", tt.action, tt.args...)
+			if err != nil {
+				t.Fatalf("script failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("terraform got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTerraformScriptRunsInWorkspaceCopy(t *testing.T) {
+	argv, dir, err := runTerraformScriptInWorkspace(t, "lab1", "0", "plan")
+	if err != nil {
+		t.Fatalf("script failed: %v", err)
+	}
+	if argv != "plan" {
+		t.Errorf("terraform got %q, want %q", argv, "plan")
+	}
+
+	want := filepath.Join(os.Getenv("ROOT_DIR"), "tf-workspaces", "lab1")
+	if dir != want {
+		t.Errorf("terraform ran in %s, want %s", dir, want)
+	}
+	if _, err := os.Stat(filepath.Join(want, "main.tf")); err != nil {
+		t.Errorf("tf directory is not copied: %v", err)
+	}
+}
+
+func TestTerraformScriptInitInWorkspaceKeepsCopy(t *testing.T) {
+	argv, dir, err := runTerraformScriptInWorkspace(t, "lab1", "0", "init")
+	if err != nil {
+		t.Fatalf("script failed: %v", err)
+	}
+	if !strings.HasPrefix(argv, "init ") {
+		t.Errorf("terraform got %q, want init", argv)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "main.tf")); err != nil {
+		t.Errorf("copy of tf directory is removed by init: %v", err)
+	}
+}
+
+func TestTerraformScriptExitCodes(t *testing.T) {
+	tests := []struct {
+		name          string
+		action        string
+		args          []string
+		terraformExit string
+		wantExit      int
+	}{
+		{"plan without changes", "plan", []string{"-detailed-exitcode"}, "0", 0},
+		{"plan with changes", "plan", []string{"-detailed-exitcode"}, "2", 2},
+		{"plan failed", "plan", []string{"-detailed-exitcode"}, "1", 1},
+		{"apply failed", "apply", nil, "1", 1},
+		{"destroy failed", "destroy", nil, "1", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := runTerraformScript(t, tt.terraformExit, tt.action, tt.args...)
+
+			exitCode := 0
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				exitCode = exitErr.ExitCode()
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if exitCode != tt.wantExit {
+				t.Errorf("exit code got %d, want %d", exitCode, tt.wantExit)
+			}
+		})
+	}
+}
@@ -2,12 +2,20 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
 
+	"one-click-aks-server/internal/auth"
 	"one-click-aks-server/internal/config"
 	"one-click-aks-server/internal/entity"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -21,6 +29,22 @@ func NewTfWorkspaceRepository(appConfig *config.Config) entity.WorkspaceReposito
 	}
 }
 
+// Lists workspaces from state blobs instead of running terraform, everything else is same as tfWorkspaceRepository.
+// azurerm backend keeps state of workspace <name> in blob <key>env:<name>, and of default workspace in blob <key>.
+type blobWorkspaceRepository struct {
+	*tfWorkspaceRepository
+	auth *auth.Auth
+}
+
+func NewBlobWorkspaceRepository(appConfig *config.Config, auth *auth.Auth) entity.WorkspaceRepository {
+	return &blobWorkspaceRepository{
+		tfWorkspaceRepository: &tfWorkspaceRepository{
+			appConfig: appConfig,
+		},
+		auth: auth,
+	}
+}
+
 var tfWorkspaceCtx = context.Background()
 
 func newTfWorkspaceRedisClient() *redis.Client {
@@ -32,21 +56,9 @@ func newTfWorkspaceRedisClient() *redis.Client {
 }
 
 func (t *tfWorkspaceRepository) List(storageAccountName string) (string, error) {
-	setEnvironmentVariable("terraform_directory", "tf")
-	setEnvironmentVariable("root_directory", os.ExpandEnv("$ROOT_DIR"))
-	setEnvironmentVariable("subscription_id", t.appConfig.ActLabsHubSubscriptionID)
-	setEnvironmentVariable("resource_group_name", t.appConfig.ActLabsHubResourceGroupName)
-	setEnvironmentVariable("storage_account_name", t.appConfig.ActLabsHubStorageAccountName)
-	setEnvironmentVariable("container_name", "repro-project-tf-state-files")
-	setEnvironmentVariable("tf_state_file_name", t.appConfig.UserAlias+"-terraform.tfstate")
-	if t.appConfig.UseServicePrincipal {
-		setEnvironmentVariable("ARM_CLIENT_ID", t.appConfig.AzureClientID)
-		setEnvironmentVariable("ARM_CLIENT_SECRET", t.appConfig.AzureClientSecret)
-		setEnvironmentVariable("ARM_SUBSCRIPTION_ID", t.appConfig.SubscriptionID)
-		setEnvironmentVariable("ARM_TENANT_ID", t.appConfig.AzureTenantID)
-	}
-
-	out, err := exec.Command(os.ExpandEnv("$ROOT_DIR")+"/scripts/workspaces.sh", "list").Output()
+	cmd := exec.Command(os.ExpandEnv("$ROOT_DIR")+"/scripts/workspaces.sh", "list")
+	cmd.Env = commandEnvironment(t.appConfig)
+	out, err := cmd.Output()
 	return string(out), err
 }
 
@@ -66,50 +78,187 @@ func (t *tfWorkspaceRepository) DeleteListFromRedis() {
 }
 
 func (t *tfWorkspaceRepository) Add(workspace entity.Workspace) error {
-	_, err := exec.Command(os.ExpandEnv("$ROOT_DIR")+"/scripts/workspaces.sh", "new", workspace.Name).Output()
+	cmd := exec.Command(os.ExpandEnv("$ROOT_DIR")+"/scripts/workspaces.sh", "new", workspace.Name)
+	cmd.Env = commandEnvironment(t.appConfig)
+	_, err := cmd.Output()
 	return err
 }
 
 func (t *tfWorkspaceRepository) Select(workspace entity.Workspace) error {
-	_, err := exec.Command(os.ExpandEnv("$ROOT_DIR")+"/scripts/workspaces.sh", "select", workspace.Name).Output()
+	cmd := exec.Command(os.ExpandEnv("$ROOT_DIR")+"/scripts/workspaces.sh", "select", workspace.Name)
+	cmd.Env = commandEnvironment(t.appConfig)
+	_, err := cmd.Output()
 	return err
 }
 
 func (t *tfWorkspaceRepository) Delete(workspace entity.Workspace) error {
-	_, err := exec.Command(os.ExpandEnv("$ROOT_DIR")+"/scripts/workspaces.sh", "delete", workspace.Name).Output()
-	return err
+	dataDir, err := workspaceDataDir(workspace.Name)
+	if err != nil {
+		return err
+	}
+	terraformDir, err := workspaceTerraformDir(workspace.Name)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(os.ExpandEnv("$ROOT_DIR")+"/scripts/workspaces.sh", "delete", workspace.Name)
+	cmd.Env = commandEnvironment(t.appConfig)
+	if _, err := cmd.Output(); err != nil {
+		return err
+	}
+
+	// Terraform data directory and copy of tf directory of the workspace are not needed anymore.
+	if err := os.RemoveAll(dataDir); err != nil {
+		return err
+	}
+	return os.RemoveAll(terraformDir)
 }
 
 func (t *tfWorkspaceRepository) Resources(storageAccountName string) (string, error) {
-	setEnvironmentVariable("terraform_directory", "tf")
-	setEnvironmentVariable("root_directory", os.ExpandEnv("$ROOT_DIR"))
-	setEnvironmentVariable("subscription_id", t.appConfig.ActLabsHubSubscriptionID)
-	setEnvironmentVariable("resource_group_name", t.appConfig.ActLabsHubResourceGroupName)
-	setEnvironmentVariable("storage_account_name", t.appConfig.ActLabsHubStorageAccountName)
-	setEnvironmentVariable("container_name", "repro-project-tf-state-files")
-	setEnvironmentVariable("tf_state_file_name", t.appConfig.UserAlias+"-terraform.tfstate")
-	if t.appConfig.UseServicePrincipal {
-		setEnvironmentVariable("ARM_CLIENT_ID", t.appConfig.AzureClientID)
-		setEnvironmentVariable("ARM_CLIENT_SECRET", t.appConfig.AzureClientSecret)
-		setEnvironmentVariable("ARM_SUBSCRIPTION_ID", t.appConfig.SubscriptionID)
-		setEnvironmentVariable("ARM_TENANT_ID", t.appConfig.AzureTenantID)
-	}
-
-	out, err := exec.Command("bash", "-c", "cd "+os.ExpandEnv("$ROOT_DIR")+"/tf; terraform state list").Output()
+	cmd := exec.Command("bash", "-c", "cd "+os.ExpandEnv("$ROOT_DIR")+"/tf; terraform show -json")
+	cmd.Env = commandEnvironment(t.appConfig)
+	out, err := cmd.Output()
 	return string(out), err
 }
 
+const (
+	resourcesRedisKey = "terraformResourceInventory"
+
+	// used to hold raw output of 'terraform state list' and then 'terraform show -json',
+	// the latter has sensitive values in state. It's removed wherever resources cache changes.
+	legacyResourcesRedisKey = "terraformResources"
+)
+
 func (t *tfWorkspaceRepository) GetResourcesFromRedis() (string, error) {
 	rdb := newTfWorkspaceRedisClient()
-	return rdb.Get(tfWorkspaceCtx, "terraformResources").Result()
+	return rdb.Get(tfWorkspaceCtx, resourcesRedisKey).Result()
 }
 
 func (t *tfWorkspaceRepository) AddResourcesToRedis(val string) {
 	rdb := newTfWorkspaceRedisClient()
-	rdb.Set(tfWorkspaceCtx, "terraformResources", val, 0)
+	rdb.Set(tfWorkspaceCtx, resourcesRedisKey, val, 0)
+	rdb.Del(tfWorkspaceCtx, legacyResourcesRedisKey)
 }
 
 func (t *tfWorkspaceRepository) DeleteResourcesFromRedis() {
 	rdb := newTfWorkspaceRedisClient()
-	rdb.Del(tfWorkspaceCtx, "terraformResources")
+	rdb.Del(tfWorkspaceCtx, resourcesRedisKey, legacyResourcesRedisKey)
+}
+
+func (t *tfWorkspaceRepository) Outputs(workspace string) (string, error) {
+	env, err := workspaceEnvironment(workspace)
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command(os.ExpandEnv("$ROOT_DIR")+"/scripts/workspaces.sh", "output")
+	cmd.Env = commandEnvironment(t.appConfig, env...)
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+const (
+	outputsRedisKey = "terraformRedactedOutputs"
+
+	// used to hold raw output of 'terraform output -json', sensitive values included.
+	// It's removed wherever outputs cache changes.
+	legacyOutputsRedisKey = "terraformOutputs"
+)
+
+func (t *tfWorkspaceRepository) GetOutputsFromRedis(workspace string) (string, error) {
+	rdb := newTfWorkspaceRedisClient()
+	return rdb.HGet(tfWorkspaceCtx, outputsRedisKey, workspace).Result()
+}
+
+func (t *tfWorkspaceRepository) AddOutputsToRedis(workspace string, val string) {
+	rdb := newTfWorkspaceRedisClient()
+	rdb.HSet(tfWorkspaceCtx, outputsRedisKey, workspace, val)
+	rdb.Del(tfWorkspaceCtx, legacyOutputsRedisKey)
+}
+
+func (t *tfWorkspaceRepository) DeleteOutputsFromRedis() {
+	rdb := newTfWorkspaceRedisClient()
+	rdb.Del(tfWorkspaceCtx, outputsRedisKey, legacyOutputsRedisKey)
+}
+
+func (t *tfWorkspaceRepository) StateList(workspace string) (string, error) {
+	env, err := workspaceEnvironment(workspace)
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command(os.ExpandEnv("$ROOT_DIR")+"/scripts/workspaces.sh", "state")
+	cmd.Env = commandEnvironment(t.appConfig, env...)
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// Output is in same format as 'workspaces.sh list'.
+func (b *blobWorkspaceRepository) List(storageAccountName string) (string, error) {
+	accountKey, err := b.auth.GetStorageAccountKey(b.appConfig.ActLabsHubSubscriptionID, b.appConfig.ActLabsHubResourceGroupName, storageAccountName)
+	if err != nil {
+		return "", fmt.Errorf("failed to get storage account key: %w", err)
+	}
+
+	containerClient, err := newContainerClient(storageAccountName, accountKey, entity.TfStateContainerName)
+	if err != nil {
+		return "", fmt.Errorf("not able to create container client: %w", err)
+	}
+
+	key := b.appConfig.UserAlias + "-terraform.tfstate"
+
+	// terraform lists default workspace even if it has no state.
+	names := []string{}
+	pager := containerClient.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{
+		Prefix: to.Ptr(key + "env:"),
+	})
+	for pager.More() {
+		page, err := pager.NextPage(context.Background())
+		if err != nil {
+			return "", fmt.Errorf("failed to list blobs: %w", err)
+		}
+
+		for _, item := range page.Segment.BlobItems {
+			if item.Name == nil {
+				continue
+			}
+			if name := strings.TrimPrefix(*item.Name, key+"env:"); name != "" && name != "default" {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	names = append([]string{"default"}, names...)
+
+	selected, err := selectedWorkspace()
+	if err != nil {
+		return "", err
+	}
+
+	list := []string{}
+	for _, name := range names {
+		if name == selected {
+			list = append(list, "* "+name)
+		} else {
+			list = append(list, " "+name)
+		}
+	}
+
+	return strings.Join(list, ","), nil
+}
+
+// Workspace selected in shared terraform data directory, terraform keeps it in 'environment' file.
+func selectedWorkspace() (string, error) {
+	val, err := os.ReadFile(filepath.Join(os.ExpandEnv("$ROOT_DIR"), "tf", ".terraform", "environment"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "default", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if selected := strings.TrimSpace(string(val)); selected != "" {
+		return selected, nil
+	}
+	return "default", nil
 }
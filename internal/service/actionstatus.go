@@ -2,6 +2,7 @@ package service
 
 import (
 	"encoding/json"
+	"sort"
 
 	"one-click-aks-server/internal/entity"
 
@@ -18,77 +19,108 @@ func NewActionStatusService(actionStatusRepository entity.ActionStatusRepository
 	}
 }
 
+// action status is derived from the action locks held.
 func (a *actionStatusService) GetActionStatus() (entity.ActionStatus, error) {
-	actionStatus := entity.ActionStatus{}
-	val, err := a.actionStatusRepository.GetActionStatus()
+	actionStatus := entity.ActionStatus{
+		Workspaces: []string{},
+	}
+
+	locks, err := a.actionStatusRepository.GetActionLocks()
 	if err != nil {
-		slog.Info("action status not found in redis")
+		slog.Error("not able to get action locks from redis", err)
+		return actionStatus, err
+	}
 
-		// Reset to default.
-		defaultActionStatus := entity.ActionStatus{
-			InProgress: false,
+	for workspace := range locks {
+		actionStatus.InProgress = true
+		if workspace != "" {
+			actionStatus.Workspaces = append(actionStatus.Workspaces, workspace)
 		}
+	}
+	sort.Strings(actionStatus.Workspaces)
 
-		if err := a.SetActionStatus(defaultActionStatus); err != nil {
-			slog.Error("not able to set default action status in redis.", err)
-		}
+	return actionStatus, nil
+}
 
-		return defaultActionStatus, nil
+// setting action status to not in progress releases all locks, used to recover from a stuck action.
+func (a *actionStatusService) SetActionStatus(actionStatus entity.ActionStatus) error {
+	if actionStatus.InProgress {
+		return a.SetActionStart()
 	}
 
-	if err = json.Unmarshal([]byte(val), &actionStatus); err != nil {
-		slog.Error("not able to translate action status string to object", err)
-		return actionStatus, err
+	if err := a.actionStatusRepository.DeleteActionLocks(); err != nil {
+		slog.Error("not able to delete action locks in redis", err)
+		return err
 	}
 
-	return actionStatus, nil
+	return a.publishActionStatus()
 }
 
-func (a *actionStatusService) SetActionStatus(actionStatus entity.ActionStatus) error {
-	val, err := json.Marshal(actionStatus)
+func (a *actionStatusService) SetActionStart() error {
+	return a.AcquireActionLock("", "")
+}
+
+func (a *actionStatusService) SetActionEnd() error {
+	return a.ReleaseActionLock("")
+}
+
+func (a *actionStatusService) AcquireActionLock(workspace string, operationId string) error {
+	acquired, err := a.actionStatusRepository.AcquireActionLock(workspace, operationId)
 	if err != nil {
-		slog.Error("not able to marshal object to string", err)
+		slog.Error("not able to acquire action lock", err)
 		return err
 	}
 
-	if err = a.actionStatusRepository.SetActionStatus(string(val)); err != nil {
-		slog.Error("not able to set actions status in redis", err)
+	if !acquired {
+		slog.Info("action in progress",
+			slog.String("workspace", workspace),
+			slog.String("operationId", operationId),
+		)
+		return entity.ErrActionInProgress
 	}
 
-	return nil
+	return a.publishActionStatus()
 }
 
-func (a *actionStatusService) SetActionStart() error {
-	actionStatus, err := a.GetActionStatus()
-	if err != nil {
-		slog.Error("not able to get current action status", err)
+func (a *actionStatusService) ReleaseActionLock(workspace string) error {
+	if err := a.actionStatusRepository.ReleaseActionLock(workspace); err != nil {
+		slog.Error("not able to release action lock", err)
 		return err
 	}
 
-	if !actionStatus.InProgress {
-		actionStatus.InProgress = true
-	}
+	return a.publishActionStatus()
+}
 
-	if err := a.SetActionStatus(actionStatus); err != nil {
-		slog.Error("not able to set action status to start", err)
+func (a *actionStatusService) GetActionLockOperationId(workspace string) (string, bool, error) {
+	locks, err := a.actionStatusRepository.GetActionLocks()
+	if err != nil {
+		slog.Error("not able to get action locks from redis", err)
+		return "", false, err
 	}
 
-	return nil
+	// server wide lock is taken without an operation id, so presence of the key is what tells it's held.
+	if operationId, ok := locks[workspace]; ok {
+		return operationId, true, nil
+	}
+	operationId, ok := locks[""]
+	return operationId, ok, nil
 }
 
-func (a *actionStatusService) SetActionEnd() error {
+// lets clients waiting for action status change know about current status.
+func (a *actionStatusService) publishActionStatus() error {
 	actionStatus, err := a.GetActionStatus()
 	if err != nil {
-		slog.Error("not able to get current action status", err)
 		return err
 	}
 
-	if actionStatus.InProgress {
-		actionStatus.InProgress = false
+	val, err := json.Marshal(actionStatus)
+	if err != nil {
+		slog.Error("not able to marshal object to string", err)
+		return err
 	}
 
-	if err := a.SetActionStatus(actionStatus); err != nil {
-		slog.Error("not able to set action status to end", err)
+	if err = a.actionStatusRepository.SetActionStatus(string(val)); err != nil {
+		slog.Error("not able to set actions status in redis", err)
 	}
 
 	return nil
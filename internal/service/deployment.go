@@ -1,6 +1,8 @@
 package service
 
 import (
+	"encoding/json"
+	"errors"
 	"os"
 	"strconv"
 	"time"
@@ -8,18 +10,20 @@ import (
 	"one-click-aks-server/internal/config"
 	"one-click-aks-server/internal/entity"
 
+	"github.com/google/uuid"
 	"golang.org/x/exp/slog"
 )
 
 type DeploymentService struct {
-	deploymentRepository entity.DeploymentRepository
-	labService           entity.LabService
-	terraformService     entity.TerraformService
-	workspaceService     entity.WorkspaceService
-	actionStatusService  entity.ActionStatusService
-	logstreamService     entity.LogStreamService
-	authService          entity.AuthService
-	config               config.Config
+	deploymentRepository  entity.DeploymentRepository
+	labService            entity.LabService
+	terraformService      entity.TerraformService
+	workspaceService      entity.WorkspaceService
+	storageAccountService entity.StorageAccountService
+	actionStatusService   entity.ActionStatusService
+	logstreamService      entity.LogStreamService
+	authService           entity.AuthService
+	config                config.Config
 }
 
 func NewDeploymentService(deploymentRepo entity.DeploymentRepository,
@@ -29,16 +33,18 @@ func NewDeploymentService(deploymentRepo entity.DeploymentRepository,
 	logstreamService entity.LogStreamService,
 	authService entity.AuthService,
 	workspaceService entity.WorkspaceService,
+	storageAccountService entity.StorageAccountService,
 	config config.Config) entity.DeploymentService {
 	return &DeploymentService{
-		deploymentRepository: deploymentRepo,
-		labService:           labService,
-		terraformService:     terraformService,
-		actionStatusService:  actionStatusService,
-		logstreamService:     logstreamService,
-		authService:          authService,
-		workspaceService:     workspaceService,
-		config:               config,
+		deploymentRepository:  deploymentRepo,
+		labService:            labService,
+		terraformService:      terraformService,
+		actionStatusService:   actionStatusService,
+		logstreamService:      logstreamService,
+		authService:           authService,
+		workspaceService:      workspaceService,
+		storageAccountService: storageAccountService,
+		config:                config,
 	}
 }
 
@@ -55,11 +61,24 @@ func (d *DeploymentService) GetMyDeployments(userId string) ([]entity.Deployment
 	// }
 
 	// get all deployments
-	deployments, err := d.deploymentRepository.GetMyDeployments(userId, d.config.SubscriptionID)
+	deploymentsString, err := d.deploymentRepository.GetMyDeployments(userId, d.config.SubscriptionID)
 	if err != nil {
 		return nil, err
 	}
 
+	// labs saved with older schema are upgraded before they are bound to current types.
+	migrated, err := helperMigrateDeploymentsJSON([]byte(deploymentsString))
+	if err != nil {
+		slog.Error("not able to migrate labs of deployments", err)
+		return nil, err
+	}
+
+	deployments := []entity.Deployment{}
+	if err := json.Unmarshal(migrated, &deployments); err != nil {
+		slog.Error("not able to unmarshal deployments", err)
+		return nil, err
+	}
+
 	// filter deployments for active account
 	var filteredDeployments []entity.Deployment
 	for _, deployment := range deployments {
@@ -99,7 +118,25 @@ func (d *DeploymentService) GetMyDeployments(userId string) ([]entity.Deployment
 }
 
 func (d *DeploymentService) GetDeployment(userId string, workspace string, subscriptionId string) (entity.Deployment, error) {
-	return d.deploymentRepository.GetDeployment(userId, workspace, subscriptionId)
+	deployment := entity.Deployment{}
+
+	deploymentString, err := d.deploymentRepository.GetDeployment(userId, workspace, subscriptionId)
+	if err != nil {
+		return deployment, err
+	}
+
+	migrated, err := helperMigrateDeploymentJSON([]byte(deploymentString))
+	if err != nil {
+		slog.Error("not able to migrate lab of deployment", err)
+		return deployment, err
+	}
+
+	if err := json.Unmarshal(migrated, &deployment); err != nil {
+		slog.Error("not able to unmarshal deployment", err)
+		return deployment, err
+	}
+
+	return deployment, nil
 }
 
 func (d *DeploymentService) GetSelectedDeployment() (entity.Deployment, error) {
@@ -130,6 +167,157 @@ func (d *DeploymentService) GetSelectedDeployment() (entity.Deployment, error) {
 	return entity.Deployment{}, nil
 }
 
+func (d *DeploymentService) GetDeploymentOutputs(workspace string, showSensitive bool) (map[string]entity.TerraformOutput, error) {
+	return d.workspaceService.Outputs(workspace, showSensitive)
+}
+
+func (d *DeploymentService) GetWorkspaceDetails(userId string) ([]entity.WorkspaceDetails, error) {
+	details := []entity.WorkspaceDetails{}
+
+	workspaces, err := d.workspaceService.List()
+	if err != nil {
+		slog.Error("not able to get workspaces", err)
+		return details, err
+	}
+
+	deployments, err := d.GetMyDeployments(userId)
+	if err != nil {
+		slog.Error("not able to get deployments", err)
+		return details, err
+	}
+
+	storageAccountName, err := d.storageAccountService.GetStorageAccountName()
+	if err != nil {
+		slog.Error("not able to get storage account name", err)
+		return details, err
+	}
+
+	deploymentsByWorkspace := map[string]entity.Deployment{}
+	for _, deployment := range deployments {
+		deploymentsByWorkspace[deployment.DeploymentWorkspace] = deployment
+	}
+
+	for _, workspace := range workspaces {
+		detail := entity.WorkspaceDetails{
+			Workspace: workspace,
+			Exists:    true,
+		}
+
+		if deployment, ok := deploymentsByWorkspace[workspace.Name]; ok {
+			detail.Deployment = &deployment
+			delete(deploymentsByWorkspace, workspace.Name)
+		} else {
+			// default workspace always exists, it can't be orphaned.
+			detail.Orphaned = workspace.Name != "default"
+		}
+
+		// workspace without state has no blob yet. Count comes from the blob so that listing
+		// doesn't run terraform in every workspace.
+		blobLease, err := d.storageAccountService.GetBlobLease(storageAccountName, entity.TfStateContainerName, workspace.Name)
+		if errors.Is(err, entity.ErrBlobNotFound) {
+			detail.ResourceCount = 0
+		} else if err != nil {
+			detail.ResourceCount = -1
+		} else {
+			detail.StateSize = blobLease.Size
+			detail.StateLastModified = blobLease.LastModified
+
+			detail.ResourceCount, err = d.storageAccountService.GetStateResourceCount(storageAccountName, entity.TfStateContainerName, workspace.Name)
+			if errors.Is(err, entity.ErrBlobNotFound) {
+				detail.ResourceCount = 0
+			} else if err != nil {
+				detail.ResourceCount = -1
+			}
+		}
+
+		details = append(details, detail)
+	}
+
+	// deployments whose workspace is gone, in order of deployments.
+	for _, deployment := range deployments {
+		if _, ok := deploymentsByWorkspace[deployment.DeploymentWorkspace]; !ok {
+			continue
+		}
+
+		deployment := deployment
+		details = append(details, entity.WorkspaceDetails{
+			Workspace:  entity.Workspace{Name: deployment.DeploymentWorkspace},
+			Deployment: &deployment,
+			Orphaned:   true,
+		})
+	}
+
+	return details, nil
+}
+
+func (d *DeploymentService) ReconcileOrphans(userId string, confirm bool) ([]entity.ReconcileAction, error) {
+	actions := []entity.ReconcileAction{}
+
+	details, err := d.GetWorkspaceDetails(userId)
+	if err != nil {
+		return actions, err
+	}
+
+	for _, detail := range details {
+		if !detail.Orphaned {
+			continue
+		}
+
+		action := entity.ReconcileAction{
+			Workspace: detail.Name,
+		}
+
+		switch {
+		case !detail.Exists:
+			action.Action = "delete-deployment"
+			action.Reason = "workspace of the deployment does not exist"
+		case detail.ResourceCount < 0:
+			action.Action = "skip"
+			action.Reason = "not able to read state of the workspace"
+		case detail.ResourceCount > 0:
+			// deleting the workspace would leave resources behind without a way to destroy them.
+			action.Action = "skip"
+			action.Reason = "workspace has " + strconv.Itoa(detail.ResourceCount) + " resources but no deployment"
+		default:
+			action.Action = "delete-workspace"
+			action.Reason = "workspace has no deployment"
+		}
+
+		if confirm && action.Action != "skip" {
+			if err := d.reconcileOrphan(action, detail); err != nil {
+				action.Error = err.Error()
+			} else {
+				action.Done = true
+			}
+		}
+
+		actions = append(actions, action)
+	}
+
+	return actions, nil
+}
+
+func (d *DeploymentService) reconcileOrphan(action entity.ReconcileAction, detail entity.WorkspaceDetails) error {
+	slog.Info("reconciling orphaned workspace",
+		slog.String("workspace", detail.Name),
+		slog.String("action", action.Action),
+	)
+
+	if action.Action == "delete-deployment" {
+		return d.deploymentRepository.DeleteDeployment(detail.Deployment.DeploymentUserId, detail.Name, detail.Deployment.DeploymentSubscriptionId)
+	}
+
+	// selected workspace can't be deleted.
+	if detail.Selected {
+		if err := d.workspaceService.Select(entity.Workspace{Name: "default", Selected: true}); err != nil {
+			slog.Error("not able to select workspace", err)
+			return err
+		}
+	}
+
+	return d.workspaceService.Delete(entity.Workspace{Name: detail.Name})
+}
+
 func (d *DeploymentService) SelectDeployment(deployment entity.Deployment) error {
 
 	// check if workspace exists, if not add it.
@@ -154,6 +342,9 @@ func (d *DeploymentService) UpsertDeployment(deployment entity.Deployment) error
 	// }
 	deployment.DeploymentSubscriptionId = d.config.SubscriptionID
 
+	// lab is bound to current types, so it is saved as current version.
+	deployment.DeploymentLab.SchemaVersion = entity.LabSchemaVersion
+
 	// check if workspace exists, if not add it.
 	if err := checkAndAddWorkspace(d, &deployment); err != nil {
 		return err
@@ -199,98 +390,172 @@ func (d *DeploymentService) PollAndDeleteDeployments(interval time.Duration) err
 	for {
 		deployments := <-dataChannel
 		for _, deployment := range deployments {
-			slog.Info("deleting deployment " + deployment.DeploymentWorkspace)
+			operation := entity.Operation{
+				OperationId: uuid.New().String(),
+				Action:      "destroy",
+				Workspace:   deployment.DeploymentWorkspace,
+				LabId:       deployment.DeploymentLab.Id,
+				LabName:     deployment.DeploymentLab.Name,
+				UserId:      deployment.DeploymentUserId,
+			}
 
-			actionStatus, err := d.actionStatusService.GetActionStatus()
-			if err != nil {
-				slog.Error("not able to get action status", err)
+			// Deployment is picked up again in next poll if its workspace is busy.
+			if err := d.actionStatusService.AcquireActionLock(deployment.DeploymentWorkspace, operation.OperationId); err != nil {
+				slog.Info("action in progress on workspace " + deployment.DeploymentWorkspace + ". will retry in next poll")
 				continue
 			}
 
-			// Wait for any action in progress to complete.
-
-			for {
-				if actionStatus.InProgress {
-					slog.Info("action in progress. waiting for 60 seconds")
-					time.Sleep(60 * time.Second)
-					actionStatus, err = d.actionStatusService.GetActionStatus()
-					if err != nil {
-						slog.Error("not able to get action status", err)
-						continue
-					}
-					continue
-				}
-				break
-			}
+			slog.Info("deleting deployment " + deployment.DeploymentWorkspace)
+			d.autoDestroyDeployment(deployment, operation)
 
-			// Get the current workspace.
-			prevSelectedDeployment, err := d.GetSelectedDeployment()
-			if err != nil {
-				slog.Error("not able to get current workspace", err)
-				continue
+			if err := d.actionStatusService.ReleaseActionLock(deployment.DeploymentWorkspace); err != nil {
+				slog.Error("not able to release action lock", err)
 			}
+		}
+	}
+}
 
-			// Change terraform workspace.
-			if err := d.ChangeTerraformWorkspace(deployment); err != nil {
-				slog.Error("not able to change terraform workspace", err)
-				continue
-			}
+// destroys the deployment, operation runs against deployment's workspace
+// so selected workspace is not changed.
+func (d *DeploymentService) autoDestroyDeployment(deployment entity.Deployment, operation entity.Operation) {
+	// Update deployment status to deleting.
+	deployment.DeploymentStatus = entity.DestroyInProgress
+	deployment.DeploymentStatusReason = ""
+	if err := d.UpsertDeployment(deployment); err != nil {
+		slog.Error("not able to update deployment", err)
+		return
+	}
 
-			// Update deployment status to deleting.
-			deployment.DeploymentStatus = entity.DestroyInProgress
-			if err := d.UpsertDeployment(deployment); err != nil {
-				slog.Error("not able to update deployment", err)
-				continue
-			}
+	//Run extend script in 'destroy' mode.
+	if err := d.terraformService.Extend(operation, deployment.DeploymentLab, "destroy"); err != nil {
+		slog.Error("not able to run extend script", err)
 
-			// Update action status to in progress.
-			d.actionStatusService.SetActionStart()
+		// Update deployment status to failed.
+		deployment.DeploymentStatus = entity.DestroyFailed
+		deployment.DeploymentStatusReason = err.Error()
+		if err := d.UpsertDeployment(deployment); err != nil {
+			slog.Error("not able to update deployment", err)
+		}
+		return
+	}
 
-			//Run extend script in 'destroy' mode.
-			if err := d.terraformService.Extend(deployment.DeploymentLab, "destroy"); err != nil {
-				slog.Error("not able to run extend script", err)
+	// Run terraform destroy.
+	if err := d.terraformService.Destroy(operation, deployment.DeploymentLab); err != nil {
+		slog.Error("not able to run terraform destroy", err)
 
-				// Update deployment status to failed.
-				deployment.DeploymentStatus = entity.DestroyFailed
-				if err := d.UpsertDeployment(deployment); err != nil {
-					slog.Error("not able to update deployment", err)
-				}
+		// Update deployment status to failed.
+		deployment.DeploymentStatus = entity.DestroyFailed
+		deployment.DeploymentStatusReason = err.Error()
+		if err := d.UpsertDeployment(deployment); err != nil {
+			slog.Error("not able to update deployment", err)
+		}
+		return
+	}
 
-				d.actionStatusService.SetActionEnd()
-				continue
-			}
+	// Update deployment status to destroyed.
+	deployment.DeploymentStatus = entity.DestroyCompleted
+	if err := d.UpsertDeployment(deployment); err != nil {
+		slog.Error("not able to update deployment", err)
+	}
+}
 
-			// Run terraform destroy.
-			if err := d.terraformService.Destroy(deployment.DeploymentLab); err != nil {
-				slog.Error("not able to run terraform destroy", err)
+func (d *DeploymentService) PollAndDetectDrift(interval time.Duration) error {
+	for {
+		time.Sleep(interval)
 
-				// Update deployment status to failed.
-				deployment.DeploymentStatus = entity.DestroyFailed
-				if err := d.UpsertDeployment(deployment); err != nil {
-					slog.Error("not able to update deployment", err)
-				}
+		deployments := d.FetchDeploymentsToCheckForDrift()
+		slog.Debug("polling for drift found " + strconv.Itoa(len(deployments)) + " deployments to check")
 
-				d.actionStatusService.SetActionEnd()
-				continue
+		for _, deployment := range deployments {
+			operation := entity.Operation{
+				OperationId: uuid.New().String(),
+				Action:      "drift",
+				Workspace:   deployment.DeploymentWorkspace,
+				LabId:       deployment.DeploymentLab.Id,
+				LabName:     deployment.DeploymentLab.Name,
+				UserId:      deployment.DeploymentUserId,
+				Background:  true,
 			}
 
-			// Update deployment status to destroyed.
-			deployment.DeploymentStatus = entity.DestroyCompleted
-			if err := d.UpsertDeployment(deployment); err != nil {
-				slog.Error("not able to update deployment", err)
-				d.actionStatusService.SetActionEnd()
+			// Deployment is checked in next poll if its workspace is busy.
+			if err := d.actionStatusService.AcquireActionLock(deployment.DeploymentWorkspace, operation.OperationId); err != nil {
+				slog.Info("action in progress on workspace " + deployment.DeploymentWorkspace + ". skipping drift check")
 				continue
 			}
 
-			// Change back to the original workspace.
-			if err := d.ChangeTerraformWorkspace(prevSelectedDeployment); err != nil {
-				slog.Error("not able to change back to original workspace", err)
-				continue
+			d.detectDrift(deployment, operation)
+
+			if err := d.actionStatusService.ReleaseActionLock(deployment.DeploymentWorkspace); err != nil {
+				slog.Error("not able to release action lock", err)
 			}
+		}
+	}
+}
+
+// plans the deployment and records drift on it. user is notified when deployment starts drifting.
+func (d *DeploymentService) detectDrift(deployment entity.Deployment, operation entity.Operation) {
+	planResult, drifted, checkErr := d.terraformService.CheckDrift(operation, deployment.DeploymentLab)
 
-			d.actionStatusService.SetActionEnd()
+	// Deployment may have been updated while plan was running.
+	latestDeployment, err := d.GetDeployment(deployment.DeploymentUserId, deployment.DeploymentWorkspace, deployment.DeploymentSubscriptionId)
+	if err == nil {
+		deployment = latestDeployment
+	}
+
+	previousDriftStatus := deployment.DeploymentDriftStatus
+	deployment.DeploymentDriftCheckedAt = time.Now().Unix()
+	deployment.DeploymentDriftedResources = []string{}
+
+	if checkErr != nil {
+		deployment.DeploymentDriftStatus = entity.DriftCheckFailed
+	} else if drifted {
+		deployment.DeploymentDriftStatus = entity.Drifted
+		for _, changes := range [][]entity.PlanResourceChange{planResult.Create, planResult.Update, planResult.Replace, planResult.Delete} {
+			for _, change := range changes {
+				deployment.DeploymentDriftedResources = append(deployment.DeploymentDriftedResources, change.Address)
+			}
 		}
+	} else {
+		deployment.DeploymentDriftStatus = entity.NoDrift
+	}
+
+	if err := d.deploymentRepository.UpsertDeployment(deployment); err != nil {
+		slog.Error("not able to update deployment drift status", err)
+		return
 	}
+
+	if deployment.DeploymentDriftStatus == entity.Drifted && previousDriftStatus != entity.Drifted {
+		notification := entity.ServerNotification{
+			Id:               uuid.New().String(),
+			NotificationType: entity.Warning,
+			Message:          "Drift detected in deployment " + deployment.DeploymentWorkspace + ", " + strconv.Itoa(len(deployment.DeploymentDriftedResources)) + " resources would change on apply.",
+			AutoClose:        0,
+		}
+		if err := d.actionStatusService.SetServerNotification(notification); err != nil {
+			slog.Error("not able to set server notification", err)
+		}
+	}
+}
+
+// Deployments that are deployed successfully are checked for drift.
+func (d *DeploymentService) FetchDeploymentsToCheckForDrift() []entity.Deployment {
+	//Get user principal from env variable.
+	userPrincipal := os.Getenv("ARM_USER_PRINCIPAL_NAME")
+
+	deployments, err := d.GetMyDeployments(userPrincipal)
+	if err != nil {
+		slog.Error("not able to get deployments", err)
+		return nil
+	}
+
+	var deploymentsToCheck []entity.Deployment
+	for _, deployment := range deployments {
+		if deployment.DeploymentStatus == entity.DeploymentCompleted {
+			deploymentsToCheck = append(deploymentsToCheck, deployment)
+		}
+	}
+
+	return deploymentsToCheck
 }
 
 func (d *DeploymentService) FetchDeploymentsToBeDeleted() []entity.Deployment {
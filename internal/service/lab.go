@@ -1,10 +1,14 @@
 package service
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"net"
+	"strings"
 
 	"one-click-aks-server/internal/entity"
+	"one-click-aks-server/internal/helper"
 
 	"golang.org/x/exp/slog"
 )
@@ -48,7 +52,13 @@ func (l *labService) GetLabFromRedis() (entity.LabType, error) {
 	}
 	slog.Debug("lab found in redis")
 
-	if err := json.Unmarshal([]byte(out), &lab); err != nil {
+	migrated, err := helperMigrateLabJSON([]byte(out))
+	if err != nil {
+		slog.Error("not able to migrate lab in redis", err)
+		migrated = []byte(out)
+	}
+
+	if err := json.Unmarshal(migrated, &lab); err != nil {
 		slog.Error("not able to unmarshal lab in redis to object", err)
 	}
 
@@ -57,6 +67,8 @@ func (l *labService) GetLabFromRedis() (entity.LabType, error) {
 
 func (l *labService) SetLabInRedis(lab entity.LabType) error {
 
+	lab.SchemaVersion = entity.LabSchemaVersion
+
 	for i := range lab.Template.KubernetesClusters {
 		if lab.Template.KubernetesClusters[i].KubernetesVersion == "" {
 			lab.Template.KubernetesClusters[i].KubernetesVersion = l.kVersionService.GetDefaultVersion()
@@ -115,7 +127,17 @@ func (l *labService) GetProtectedLab(typeOfLab string, labId string) (entity.Lab
 		return lab, fmt.Errorf("not able to get protected %s", err.Error())
 	}
 
-	if err := json.Unmarshal([]byte(labString), &lab); err != nil {
+	migrated, err := helperMigrateLabJSON([]byte(labString))
+	if err != nil {
+		slog.Error("not able to migrate lab object",
+			slog.String("typeOfLab", typeOfLab),
+			slog.String("labId", labId),
+			slog.String("error", err.Error()),
+		)
+		return lab, fmt.Errorf("not able to migrate lab object %s", err.Error())
+	}
+
+	if err := json.Unmarshal(migrated, &lab); err != nil {
 		slog.Error("not able to unmarshal lab object",
 			slog.String("typeOfLab", typeOfLab),
 			slog.String("labId", labId),
@@ -228,11 +250,317 @@ func (l *labService) HelperDefaultLab() (entity.LabType, error) {
 	}
 
 	var defaultLab = entity.LabType{
-		Tags:         []string{},
-		Template:     defaultTfvar,
-		Type:         "privatelab",
-		ExtendScript: extendScript,
+		SchemaVersion: entity.LabSchemaVersion,
+		Tags:          []string{},
+		Template:      defaultTfvar,
+		Type:          "privatelab",
+		ExtendScript:  extendScript,
 	}
 
 	return defaultLab, nil
 }
+
+func (l *labService) GetLabSchema() map[string]interface{} {
+	return helperJSONSchema(entity.LabType{}, "Lab", labSchemaEnums)
+}
+
+func (l *labService) ExportLab(format string) (string, error) {
+	lab, err := l.GetLabFromRedis()
+	if err != nil {
+		return "", err
+	}
+
+	variables := helper.TfvarVariables(lab.Template)
+
+	switch format {
+	case entity.TfvarsFormatJSON:
+		return helperTfvarsJSON(variables)
+	case entity.TfvarsFormatHCL:
+		return helperTfvarsHCL(variables)
+	default:
+		return "", entity.ErrUnsupportedTfvarsFormat
+	}
+}
+
+func (l *labService) ImportLab(format string, data []byte) (entity.LabType, error) {
+	if format == "" {
+		format = entity.TfvarsFormatHCL
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+			format = entity.TfvarsFormatJSON
+		}
+	}
+
+	var variables []entity.TfvarVariable
+	var err error
+	switch format {
+	case entity.TfvarsFormatJSON:
+		variables, err = helperParseTfvarsJSON(data)
+	case entity.TfvarsFormatHCL:
+		variables, err = helperParseTfvarsHCL(data)
+	default:
+		return entity.LabType{}, entity.ErrUnsupportedTfvarsFormat
+	}
+	if err != nil {
+		return entity.LabType{}, fmt.Errorf("%w: %s", entity.ErrInvalidTfvars, err.Error())
+	}
+
+	template, err := helperTfvarConfigFromVariables(variables)
+	if err != nil {
+		return entity.LabType{}, fmt.Errorf("%w: %s", entity.ErrInvalidTfvars, err.Error())
+	}
+
+	// rest of the lab, like extend script, is same as a new lab.
+	lab, err := l.HelperDefaultLab()
+	if err != nil {
+		return entity.LabType{}, err
+	}
+	lab.Template = template
+
+	return lab, nil
+}
+
+// subnets are used by position in terraform.
+const (
+	firewallSubnetIndex   = 0
+	jumpserverSubnetIndex = 1
+	clusterSubnetIndex    = 2
+	appGatewaySubnetIndex = 3
+)
+
+func (l *labService) ValidateLab(lab entity.LabType) entity.LabValidationResult {
+	v := &labValidator{
+		result: entity.LabValidationResult{
+			Errors:   []entity.LabValidationIssue{},
+			Warnings: []entity.LabValidationIssue{},
+		},
+	}
+
+	template := lab.Template
+
+	if template.ResourceGroup.Location == "" {
+		v.error("template.resourceGroup.location", "location is required")
+	}
+
+	helperValidateNetwork(v, template)
+
+	for i, jumpserver := range template.Jumpservers {
+		path := fmt.Sprintf("template.jumpservers[%d]", i)
+		if jumpserver.AdminUserName == "" {
+			v.error(path+".adminUsername", "admin username is required")
+		}
+		if jumpserver.AdminPassword == "" {
+			v.error(path+".adminPassword", "admin password is required")
+		} else if len(jumpserver.AdminPassword) < 12 || len(jumpserver.AdminPassword) > 123 {
+			v.error(path+".adminPassword", "admin password must be 12 to 123 characters long")
+		}
+		if len(template.Subnets) <= jumpserverSubnetIndex {
+			v.error(path, fmt.Sprintf("jumpserver is deployed to subnet %d, add a virtual network with at least %d subnets", jumpserverSubnetIndex, jumpserverSubnetIndex+1))
+		}
+	}
+
+	for i, firewall := range template.Firewalls {
+		path := fmt.Sprintf("template.firewalls[%d]", i)
+		if len(template.Subnets) <= firewallSubnetIndex {
+			v.error(path, fmt.Sprintf("firewall is deployed to subnet %d, add a virtual network with subnets", firewallSubnetIndex))
+		} else if template.Subnets[firewallSubnetIndex].Name != "AzureFirewallSubnet" {
+			v.error(fmt.Sprintf("template.subnets[%d].name", firewallSubnetIndex), "subnet of firewall must be named AzureFirewallSubnet")
+		}
+		if firewall.SkuName == "" {
+			v.error(path+".skuName", "sku name is required")
+		}
+		if firewall.SkuTier == "" {
+			v.error(path+".skuTier", "sku tier is required")
+		}
+	}
+
+	for i, cluster := range template.KubernetesClusters {
+		helperValidateCluster(v, l.kVersionService, template, cluster, fmt.Sprintf("template.kubernetesClusters[%d]", i))
+	}
+
+	v.result.Valid = len(v.result.Errors) == 0
+	return v.result
+}
+
+type labValidator struct {
+	result entity.LabValidationResult
+}
+
+func (v *labValidator) error(path string, message string) {
+	v.result.Errors = append(v.result.Errors, entity.LabValidationIssue{Path: path, Message: message})
+}
+
+func (v *labValidator) warning(path string, message string) {
+	v.result.Warnings = append(v.result.Warnings, entity.LabValidationIssue{Path: path, Message: message})
+}
+
+// Subnets are created in the first virtual network and must be inside its address space.
+func helperValidateNetwork(v *labValidator, template entity.TfvarConfigType) {
+	if len(template.Subnets) > 0 && len(template.VirtualNetworks) == 0 {
+		v.error("template.subnets", "subnets require a virtual network")
+	}
+	if len(template.VirtualNetworks) > 1 {
+		v.warning("template.virtualNetworks", "only the first virtual network is used for subnets")
+	}
+
+	addressSpaces := []*net.IPNet{}
+	for i, virtualNetwork := range template.VirtualNetworks {
+		path := fmt.Sprintf("template.virtualNetworks[%d].AddressSpace", i)
+		if len(virtualNetwork.AddressSpace) == 0 {
+			v.error(path, "address space is required")
+		}
+		for j, cidr := range virtualNetwork.AddressSpace {
+			_, ipNet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				v.error(fmt.Sprintf("%s[%d]", path, j), cidr+" is not a valid CIDR")
+				continue
+			}
+			if i == 0 {
+				addressSpaces = append(addressSpaces, ipNet)
+			}
+		}
+	}
+
+	type subnetPrefix struct {
+		path  string
+		ipNet *net.IPNet
+	}
+	prefixes := []subnetPrefix{}
+	names := map[string]int{}
+
+	for i, subnet := range template.Subnets {
+		path := fmt.Sprintf("template.subnets[%d]", i)
+
+		if subnet.Name == "" {
+			v.error(path+".Name", "name is required")
+		} else if first, ok := names[subnet.Name]; ok {
+			v.error(path+".Name", fmt.Sprintf("name %s is already used by subnet %d", subnet.Name, first))
+		} else {
+			names[subnet.Name] = i
+		}
+
+		if len(subnet.AddressPrefixes) == 0 {
+			v.error(path+".AddressPrefixes", "address prefixes are required")
+		}
+
+		for j, cidr := range subnet.AddressPrefixes {
+			prefixPath := fmt.Sprintf("%s.AddressPrefixes[%d]", path, j)
+			_, ipNet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				v.error(prefixPath, cidr+" is not a valid CIDR")
+				continue
+			}
+
+			if len(addressSpaces) > 0 && !helperCIDRWithinAny(ipNet, addressSpaces) {
+				v.error(prefixPath, cidr+" is outside address space of the virtual network")
+			}
+
+			for _, other := range prefixes {
+				if helperCIDRsOverlap(ipNet, other.ipNet) {
+					v.error(prefixPath, cidr+" overlaps "+other.ipNet.String()+" of "+other.path)
+				}
+			}
+			prefixes = append(prefixes, subnetPrefix{path: prefixPath, ipNet: ipNet})
+		}
+	}
+}
+
+func helperValidateCluster(v *labValidator, kVersionService entity.KVersionService, template entity.TfvarConfigType, cluster entity.TfvarKubernetesClusterType, path string) {
+	if cluster.KubernetesVersion != "" && !kVersionService.DoesVersionExist(cluster.KubernetesVersion) {
+		v.warning(path+".kubernetesVersion", "version "+cluster.KubernetesVersion+" is not available, default version will be used")
+	}
+
+	helperValidateEnum(v, path+".networkPlugin", "TfvarKubernetesClusterType.networkPlugin", cluster.NetworkPlugin)
+	helperValidateEnum(v, path+".networkPluginMode", "TfvarKubernetesClusterType.networkPluginMode", cluster.NetworkPluginMode)
+	helperValidateEnum(v, path+".networkPolicy", "TfvarKubernetesClusterType.networkPolicy", cluster.NetworkPolicy)
+	helperValidateEnum(v, path+".outboundType", "TfvarKubernetesClusterType.outboundType", cluster.OutboundType)
+	helperValidateEnum(v, path+".privateClusterEnabled", "TfvarKubernetesClusterType.privateClusterEnabled", cluster.PrivateClusterEnabled)
+	helperValidateEnum(v, path+".defaultNodePool.osSku", "TfvarDefaultNodePoolType.osSku", cluster.DefaultNodePool.OsSku)
+
+	nodePool := cluster.DefaultNodePool
+	if nodePool.EnableAutoScaling {
+		if nodePool.MinCount < 1 {
+			v.error(path+".defaultNodePool.minCount", "min count must be at least 1")
+		}
+		if nodePool.MinCount > nodePool.MaxCount {
+			v.error(path+".defaultNodePool.minCount", fmt.Sprintf("min count %d is greater than max count %d", nodePool.MinCount, nodePool.MaxCount))
+		}
+	}
+
+	if cluster.NetworkPluginMode == "overlay" && cluster.NetworkPlugin != "azure" {
+		v.error(path+".networkPluginMode", "overlay mode requires network plugin azure, got "+cluster.NetworkPlugin)
+	}
+	if cluster.NetworkPolicy == "azure" && cluster.NetworkPlugin != "azure" {
+		v.error(path+".networkPolicy", "azure network policy requires network plugin azure, got "+cluster.NetworkPlugin)
+	}
+
+	if cluster.OutboundType == "userDefinedRouting" {
+		if len(template.Firewalls) == 0 || len(template.VirtualNetworks) == 0 {
+			v.error(path+".outboundType", "user defined routing requires a virtual network and a firewall")
+		}
+	}
+
+	if cluster.PrivateClusterEnabled == "true" && len(template.Jumpservers) == 0 {
+		v.error(path+".privateClusterEnabled", "private cluster is only reachable from the virtual network, add a jumpserver")
+	}
+
+	if len(template.VirtualNetworks) > 0 && len(template.Subnets) <= clusterSubnetIndex {
+		v.error(path, fmt.Sprintf("cluster is deployed to subnet %d, add at least %d subnets", clusterSubnetIndex, clusterSubnetIndex+1))
+	}
+
+	if cluster.Addons.AppGateway && len(template.VirtualNetworks) > 0 && len(template.Subnets) <= appGatewaySubnetIndex {
+		v.error(path+".addons.appGateway", fmt.Sprintf("app gateway is deployed to subnet %d, add at least %d subnets", appGatewaySubnetIndex, appGatewaySubnetIndex+1))
+	}
+	if cluster.Addons.AppGateway && len(template.VirtualNetworks) == 0 {
+		v.warning(path+".addons.appGateway", "app gateway is only enabled with a virtual network")
+	}
+
+	if cluster.Addons.VirtualNode {
+		if cluster.NetworkPlugin != "azure" {
+			v.error(path+".addons.virtualNode", "virtual node requires network plugin azure")
+		}
+		found := false
+		for _, subnet := range template.Subnets {
+			if subnet.Name == "KubernetesVirtualNodeSubnet" {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.error(path+".addons.virtualNode", "virtual node requires a subnet named KubernetesVirtualNodeSubnet")
+		}
+	}
+
+	if cluster.Addons.ServiceMesh.Enabled && cluster.Addons.ServiceMesh.Mode == "" {
+		v.error(path+".addons.serviceMesh.mode", "mode is required when service mesh is enabled")
+	}
+
+	if cluster.WorkloadIdentityEnabled && !cluster.OidcIssuerEnabled {
+		v.warning(path+".workloadIdentityEnabled", "workload identity needs oidc issuer, it will be enabled too")
+	}
+}
+
+// value must be one of the enum of the field in lab schema.
+func helperValidateEnum(v *labValidator, path string, field string, value string) {
+	for _, allowed := range labSchemaEnums[field] {
+		if value == allowed {
+			return
+		}
+	}
+	v.error(path, fmt.Sprintf("%q is not one of %s", value, strings.Join(labSchemaEnums[field], ", ")))
+}
+
+// true if cidr is inside one of the address spaces.
+func helperCIDRWithinAny(ipNet *net.IPNet, addressSpaces []*net.IPNet) bool {
+	ones, _ := ipNet.Mask.Size()
+	for _, addressSpace := range addressSpaces {
+		spaceOnes, _ := addressSpace.Mask.Size()
+		if addressSpace.Contains(ipNet.IP) && ones >= spaceOnes {
+			return true
+		}
+	}
+	return false
+}
+
+func helperCIDRsOverlap(a *net.IPNet, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"one-click-aks-server/internal/entity"
+
+	"golang.org/x/exp/slog"
+)
+
+// labMigrations[i] upgrades lab JSON from schema version i to i+1.
+// Labs saved before versioning have no schemaVersion and are version 0.
+var labMigrations = []func(lab map[string]interface{}){
+	// 0 -> 1: privateClusterEnabled was a bool, and unset network policy and plugin mode
+	// must be "null" to be passed as null to terraform.
+	func(lab map[string]interface{}) {
+		for _, cluster := range helperLabClusters(lab) {
+			if enabled, ok := cluster["privateClusterEnabled"].(bool); ok {
+				cluster["privateClusterEnabled"] = fmt.Sprintf("%t", enabled)
+			}
+			helperDefaultValue(cluster, "privateClusterEnabled", "false")
+			for _, key := range []string{"networkPolicy", "networkPluginMode"} {
+				if value, _ := cluster[key].(string); value == "" {
+					cluster[key] = "null"
+				}
+			}
+		}
+	},
+	// 1 -> 2: fields added to cluster get the values default lab uses.
+	func(lab map[string]interface{}) {
+		for _, cluster := range helperLabClusters(lab) {
+			helperDefaultValue(cluster, "networkPlugin", "kubenet")
+			helperDefaultValue(cluster, "outboundType", "loadBalancer")
+
+			if nodePool, ok := cluster["defaultNodePool"].(map[string]interface{}); ok {
+				helperDefaultValue(nodePool, "osSku", "Ubuntu")
+				helperDefaultValue(nodePool, "minCount", 1)
+				helperDefaultValue(nodePool, "maxCount", 1)
+			}
+
+			if addons, ok := cluster["addons"].(map[string]interface{}); ok {
+				if serviceMesh, ok := addons["serviceMesh"].(map[string]interface{}); ok {
+					helperDefaultValue(serviceMesh, "mode", "Istio")
+				}
+			}
+		}
+	},
+}
+
+// upgrades lab JSON to entity.LabSchemaVersion. Lab of a newer version is returned as is.
+func helperMigrateLabJSON(data []byte) ([]byte, error) {
+	lab := map[string]interface{}{}
+	if err := json.Unmarshal(data, &lab); err != nil {
+		return nil, err
+	}
+
+	if !helperMigrateLab(lab) {
+		return data, nil
+	}
+	return json.Marshal(lab)
+}
+
+// upgrades lab of each deployment in JSON list of deployments.
+func helperMigrateDeploymentsJSON(data []byte) ([]byte, error) {
+	deployments := []map[string]interface{}{}
+	if err := json.Unmarshal(data, &deployments); err != nil {
+		return nil, err
+	}
+
+	migrated := false
+	for _, deployment := range deployments {
+		if lab, ok := deployment["deploymentLab"].(map[string]interface{}); ok {
+			migrated = helperMigrateLab(lab) || migrated
+		}
+	}
+
+	if !migrated {
+		return data, nil
+	}
+	return json.Marshal(deployments)
+}
+
+// upgrades lab of the deployment in JSON of deployment.
+func helperMigrateDeploymentJSON(data []byte) ([]byte, error) {
+	deployment := map[string]interface{}{}
+	if err := json.Unmarshal(data, &deployment); err != nil {
+		return nil, err
+	}
+
+	lab, ok := deployment["deploymentLab"].(map[string]interface{})
+	if !ok || !helperMigrateLab(lab) {
+		return data, nil
+	}
+	return json.Marshal(deployment)
+}
+
+// returns false if lab is already at current version.
+func helperMigrateLab(lab map[string]interface{}) bool {
+	version := 0
+	if v, ok := lab["schemaVersion"].(float64); ok {
+		version = int(v)
+	}
+	if version >= entity.LabSchemaVersion {
+		return false
+	}
+
+	for ; version < entity.LabSchemaVersion && version < len(labMigrations); version++ {
+		labMigrations[version](lab)
+	}
+
+	slog.Debug("lab migrated",
+		slog.String("labId", fmt.Sprint(lab["id"])),
+		slog.Int("schemaVersion", version),
+	)
+
+	lab["schemaVersion"] = version
+	return true
+}
+
+func helperLabClusters(lab map[string]interface{}) []map[string]interface{} {
+	clusters := []map[string]interface{}{}
+	template, ok := lab["template"].(map[string]interface{})
+	if !ok {
+		return clusters
+	}
+	items, _ := template["kubernetesClusters"].([]interface{})
+	for _, item := range items {
+		if cluster, ok := item.(map[string]interface{}); ok {
+			clusters = append(clusters, cluster)
+		}
+	}
+	return clusters
+}
+
+// sets value if key is missing or null.
+func helperDefaultValue(m map[string]interface{}, key string, value interface{}) {
+	if m[key] == nil {
+		m[key] = value
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"one-click-aks-server/internal/entity"
+)
+
+func TestHelperMigrateLabJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		lab  string
+		want entity.TfvarKubernetesClusterType
+	}{
+		{
+			name: "unversioned lab with bool private cluster",
+			lab:  `{"template":{"kubernetesClusters":[{"privateClusterEnabled":true,"networkPolicy":"","defaultNodePool":{},"addons":{"serviceMesh":{}}}]}}`,
+			want: entity.TfvarKubernetesClusterType{
+				NetworkPlugin:         "kubenet",
+				NetworkPolicy:         "null",
+				NetworkPluginMode:     "null",
+				OutboundType:          "loadBalancer",
+				PrivateClusterEnabled: "true",
+				Addons:                entity.TfvarAddonsType{ServiceMesh: entity.TfvarServiceMeshType{Mode: "Istio"}},
+				DefaultNodePool:       entity.TfvarDefaultNodePoolType{MinCount: 1, MaxCount: 1, OsSku: "Ubuntu"},
+			},
+		},
+		{
+			name: "version 1 lab keeps its values",
+			lab:  `{"schemaVersion":1,"template":{"kubernetesClusters":[{"networkPlugin":"azure","networkPolicy":"calico","networkPluginMode":"overlay","privateClusterEnabled":"false","outboundType":"userDefinedRouting","defaultNodePool":{"minCount":2,"maxCount":3,"osSku":"AzureLinux"}}]}}`,
+			want: entity.TfvarKubernetesClusterType{
+				NetworkPlugin:         "azure",
+				NetworkPolicy:         "calico",
+				NetworkPluginMode:     "overlay",
+				OutboundType:          "userDefinedRouting",
+				PrivateClusterEnabled: "false",
+				DefaultNodePool:       entity.TfvarDefaultNodePoolType{MinCount: 2, MaxCount: 3, OsSku: "AzureLinux"},
+			},
+		},
+		{
+			name: "current lab is not changed",
+			lab:  `{"schemaVersion":2,"template":{"kubernetesClusters":[{"networkPolicy":""}]}}`,
+			want: entity.TfvarKubernetesClusterType{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrated, err := helperMigrateLabJSON([]byte(tt.lab))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			lab := entity.LabType{}
+			if err := json.Unmarshal(migrated, &lab); err != nil {
+				t.Fatal(err)
+			}
+			if lab.SchemaVersion != entity.LabSchemaVersion {
+				t.Errorf("schemaVersion got %d, want %d", lab.SchemaVersion, entity.LabSchemaVersion)
+			}
+			if got := lab.Template.KubernetesClusters[0]; got != tt.want {
+				t.Errorf("cluster got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHelperMigrateDeploymentJSON(t *testing.T) {
+	deployment := `{"deploymentWorkspace":"lab1","deploymentLab":{"template":{"kubernetesClusters":[{"privateClusterEnabled":false}]}}}`
+
+	single, err := helperMigrateDeploymentJSON([]byte(deployment))
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := helperMigrateDeploymentsJSON([]byte("[" + deployment + "]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := entity.Deployment{}
+	if err := json.Unmarshal(single, &got); err != nil {
+		t.Fatal(err)
+	}
+	gotList := []entity.Deployment{}
+	if err := json.Unmarshal(list, &gotList); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, d := range []entity.Deployment{got, gotList[0]} {
+		if d.DeploymentWorkspace != "lab1" {
+			t.Errorf("deploymentWorkspace got %q", d.DeploymentWorkspace)
+		}
+		if d.DeploymentLab.Template.KubernetesClusters[0].PrivateClusterEnabled != "false" {
+			t.Errorf("privateClusterEnabled is not migrated: %+v", d.DeploymentLab.Template.KubernetesClusters[0])
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+)
+
+// allowed values of template fields, keyed by '<TypeName>.<jsonName>'.
+// "null" is how lab sets optional values to null in terraform.
+var labSchemaEnums = map[string][]string{
+	"TfvarKubernetesClusterType.networkPlugin":         {"azure", "kubenet", "none"},
+	"TfvarKubernetesClusterType.networkPluginMode":     {"null", "", "overlay"},
+	"TfvarKubernetesClusterType.networkPolicy":         {"null", "", "azure", "calico", "cilium"},
+	"TfvarKubernetesClusterType.outboundType":          {"", "loadBalancer", "userDefinedRouting", "managedNATGateway", "userAssignedNATGateway"},
+	"TfvarKubernetesClusterType.privateClusterEnabled": {"true", "false"},
+	"TfvarDefaultNodePoolType.osSku":                   {"", "Ubuntu", "AzureLinux", "CBLMariner", "Mariner"},
+	"TfvarServiceMeshType.mode":                        {"", "Istio"},
+}
+
+// helperJSONSchema generates JSON Schema of the type of v from its json tags. Struct types go to $defs
+// and don't allow unknown properties. Enums are keyed by '<TypeName>.<jsonName>'.
+func helperJSONSchema(v interface{}, title string, enums map[string][]string) map[string]interface{} {
+	defs := map[string]interface{}{}
+	schema := helperJSONSchemaOf(reflect.TypeOf(v), defs, enums)
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = title
+	schema["$defs"] = defs
+	return schema
+}
+
+func helperJSONSchemaOf(t reflect.Type, defs map[string]interface{}, enums map[string][]string) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return helperJSONSchemaOf(t.Elem(), defs, enums)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": helperJSONSchemaOf(t.Elem(), defs, enums)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": helperJSONSchemaOf(t.Elem(), defs, enums)}
+	case reflect.Struct:
+		if _, ok := defs[t.Name()]; !ok {
+			// placeholder stops recursion of self referencing types.
+			defs[t.Name()] = map[string]interface{}{}
+
+			properties := map[string]interface{}{}
+			for i := 0; i < t.NumField(); i++ {
+				field := t.Field(i)
+				if !field.IsExported() {
+					continue
+				}
+
+				name := field.Name
+				if tag := field.Tag.Get("json"); tag != "" {
+					if tag == "-" {
+						continue
+					}
+					if tagName := strings.Split(tag, ",")[0]; tagName != "" {
+						name = tagName
+					}
+				}
+
+				property := helperJSONSchemaOf(field.Type, defs, enums)
+				if enum, ok := enums[t.Name()+"."+name]; ok {
+					property["enum"] = enum
+				}
+				properties[name] = property
+			}
+
+			defs[t.Name()] = map[string]interface{}{
+				"type":                 "object",
+				"properties":           properties,
+				"additionalProperties": false,
+			}
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+	default:
+		return map[string]interface{}{}
+	}
+}
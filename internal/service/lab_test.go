@@ -0,0 +1,245 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"one-click-aks-server/internal/entity"
+)
+
+type fakeKVersionService struct {
+	entity.KVersionService
+}
+
+func (fakeKVersionService) DoesVersionExist(version string) bool {
+	return version == "1.28.3"
+}
+
+// template that passes validation, cases change it to make it fail.
+func helperValidTemplate() entity.TfvarConfigType {
+	return entity.TfvarConfigType{
+		ResourceGroup:   entity.TfvarResourceGroupType{Location: "East US"},
+		VirtualNetworks: []entity.TfvarVirtualNetworkType{{AddressSpace: []string{"10.1.0.0/16"}}},
+		Subnets: []entity.TfvarSubnetType{
+			{Name: "AzureFirewallSubnet", AddressPrefixes: []string{"10.1.1.0/24"}},
+			{Name: "JumpServerSubnet", AddressPrefixes: []string{"10.1.2.0/24"}},
+			{Name: "KubernetesSubnet", AddressPrefixes: []string{"10.1.3.0/24"}},
+			{Name: "AppGatewaySubnet", AddressPrefixes: []string{"10.1.4.0/24"}},
+		},
+		Jumpservers: []entity.TfvarJumpserverType{{AdminUserName: "azureuser", AdminPassword: "Passw0rd1234"}},
+		Firewalls:   []entity.TfvarFirewallType{{SkuName: "AZFW_VNet", SkuTier: "Standard"}},
+		KubernetesClusters: []entity.TfvarKubernetesClusterType{{
+			KubernetesVersion:     "1.28.3",
+			NetworkPlugin:         "azure",
+			NetworkPolicy:         "null",
+			NetworkPluginMode:     "null",
+			OutboundType:          "loadBalancer",
+			PrivateClusterEnabled: "false",
+			DefaultNodePool:       entity.TfvarDefaultNodePoolType{MinCount: 1, MaxCount: 1, OsSku: "Ubuntu"},
+		}},
+	}
+}
+
+func TestValidateLab(t *testing.T) {
+	tests := []struct {
+		name         string
+		change       func(template *entity.TfvarConfigType)
+		wantErrors   []string
+		wantWarnings []string
+	}{
+		{
+			name:   "valid",
+			change: func(template *entity.TfvarConfigType) {},
+		},
+		{
+			name:       "location is required",
+			change:     func(template *entity.TfvarConfigType) { template.ResourceGroup.Location = "" },
+			wantErrors: []string{"template.resourceGroup.location"},
+		},
+		{
+			name: "invalid address space",
+			change: func(template *entity.TfvarConfigType) {
+				template.VirtualNetworks[0].AddressSpace = []string{"10.1.0.0/16", "10.300.0.0/16"}
+			},
+			wantErrors: []string{"template.virtualNetworks[0].AddressSpace[1]"},
+		},
+		{
+			name: "subnet outside address space",
+			change: func(template *entity.TfvarConfigType) {
+				template.Subnets[2].AddressPrefixes = []string{"10.2.3.0/24"}
+			},
+			wantErrors: []string{"template.subnets[2].AddressPrefixes[0]"},
+		},
+		{
+			name: "subnet spanning address spaces",
+			change: func(template *entity.TfvarConfigType) {
+				template.VirtualNetworks[0].AddressSpace = []string{"10.1.0.0/24", "10.1.1.0/24", "10.1.2.0/24"}
+				template.Subnets = []entity.TfvarSubnetType{
+					{Name: "AzureFirewallSubnet", AddressPrefixes: []string{"10.1.2.0/26"}},
+					{Name: "JumpServerSubnet", AddressPrefixes: []string{"10.1.2.64/26"}},
+					{Name: "KubernetesSubnet", AddressPrefixes: []string{"10.1.0.0/23"}},
+					{Name: "AppGatewaySubnet", AddressPrefixes: []string{"10.1.2.128/26"}},
+				}
+			},
+			wantErrors: []string{"template.subnets[2].AddressPrefixes[0]"},
+		},
+		{
+			name: "subnet in any of the address spaces",
+			change: func(template *entity.TfvarConfigType) {
+				template.VirtualNetworks[0].AddressSpace = []string{"10.1.0.0/16", "10.2.0.0/16"}
+				template.Subnets[3].AddressPrefixes = []string{"10.2.4.0/24"}
+			},
+		},
+		{
+			name: "overlapping subnets",
+			change: func(template *entity.TfvarConfigType) {
+				template.Subnets[3].AddressPrefixes = []string{"10.1.3.128/25"}
+			},
+			wantErrors: []string{"template.subnets[3].AddressPrefixes[0]"},
+		},
+		{
+			name: "invalid subnet prefix",
+			change: func(template *entity.TfvarConfigType) {
+				template.Subnets[1].AddressPrefixes = []string{"10.1.2.0"}
+			},
+			wantErrors: []string{"template.subnets[1].AddressPrefixes[0]"},
+		},
+		{
+			name: "duplicate subnet name",
+			change: func(template *entity.TfvarConfigType) {
+				template.Subnets[3].Name = "KubernetesSubnet"
+			},
+			wantErrors: []string{"template.subnets[3].Name"},
+		},
+		{
+			name: "subnets without virtual network",
+			change: func(template *entity.TfvarConfigType) {
+				template.VirtualNetworks = nil
+			},
+			wantErrors: []string{"template.subnets"},
+		},
+		{
+			name: "only first virtual network is used",
+			change: func(template *entity.TfvarConfigType) {
+				template.VirtualNetworks = append(template.VirtualNetworks, entity.TfvarVirtualNetworkType{AddressSpace: []string{"10.2.0.0/16"}})
+			},
+			wantWarnings: []string{"template.virtualNetworks"},
+		},
+		{
+			name: "firewall subnet name",
+			change: func(template *entity.TfvarConfigType) {
+				template.Subnets[0].Name = "FirewallSubnet"
+			},
+			wantErrors: []string{"template.subnets[0].name"},
+		},
+		{
+			name: "jumpserver needs its subnet",
+			change: func(template *entity.TfvarConfigType) {
+				template.Subnets = template.Subnets[:1]
+			},
+			wantErrors: []string{"template.jumpservers[0]", "template.kubernetesClusters[0]"},
+		},
+		{
+			name: "cluster needs its subnet",
+			change: func(template *entity.TfvarConfigType) {
+				template.Subnets = template.Subnets[:2]
+			},
+			wantErrors: []string{"template.kubernetesClusters[0]"},
+		},
+		{
+			name: "app gateway needs its subnet",
+			change: func(template *entity.TfvarConfigType) {
+				template.Subnets = template.Subnets[:3]
+				template.KubernetesClusters[0].Addons.AppGateway = true
+			},
+			wantErrors: []string{"template.kubernetesClusters[0].addons.appGateway"},
+		},
+		{
+			name: "short jumpserver password",
+			change: func(template *entity.TfvarConfigType) {
+				template.Jumpservers[0].AdminPassword = "short"
+			},
+			wantErrors: []string{"template.jumpservers[0].adminPassword"},
+		},
+		{
+			name: "unknown enum value",
+			change: func(template *entity.TfvarConfigType) {
+				template.KubernetesClusters[0].NetworkPlugin = "cni"
+			},
+			wantErrors: []string{"template.kubernetesClusters[0].networkPlugin"},
+		},
+		{
+			name: "overlay requires azure plugin",
+			change: func(template *entity.TfvarConfigType) {
+				template.KubernetesClusters[0].NetworkPlugin = "kubenet"
+				template.KubernetesClusters[0].NetworkPluginMode = "overlay"
+			},
+			wantErrors: []string{"template.kubernetesClusters[0].networkPluginMode"},
+		},
+		{
+			name: "user defined routing requires firewall",
+			change: func(template *entity.TfvarConfigType) {
+				template.Firewalls = nil
+				template.KubernetesClusters[0].OutboundType = "userDefinedRouting"
+			},
+			wantErrors: []string{"template.kubernetesClusters[0].outboundType"},
+		},
+		{
+			name: "private cluster requires jumpserver",
+			change: func(template *entity.TfvarConfigType) {
+				template.Jumpservers = nil
+				template.KubernetesClusters[0].PrivateClusterEnabled = "true"
+			},
+			wantErrors: []string{"template.kubernetesClusters[0].privateClusterEnabled"},
+		},
+		{
+			name: "autoscaling min greater than max",
+			change: func(template *entity.TfvarConfigType) {
+				template.KubernetesClusters[0].DefaultNodePool = entity.TfvarDefaultNodePoolType{EnableAutoScaling: true, MinCount: 3, MaxCount: 2, OsSku: "Ubuntu"}
+			},
+			wantErrors: []string{"template.kubernetesClusters[0].defaultNodePool.minCount"},
+		},
+		{
+			name: "unknown kubernetes version",
+			change: func(template *entity.TfvarConfigType) {
+				template.KubernetesClusters[0].KubernetesVersion = "1.10.0"
+			},
+			wantWarnings: []string{"template.kubernetesClusters[0].kubernetesVersion"},
+		},
+	}
+
+	l := &labService{kVersionService: fakeKVersionService{}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := helperValidTemplate()
+			tt.change(&template)
+
+			result := l.ValidateLab(entity.LabType{Template: template})
+
+			if got := helperIssuePaths(result.Errors); !reflect.DeepEqual(got, helperNonNil(tt.wantErrors)) {
+				t.Errorf("errors got %v, want %v", result.Errors, tt.wantErrors)
+			}
+			if got := helperIssuePaths(result.Warnings); !reflect.DeepEqual(got, helperNonNil(tt.wantWarnings)) {
+				t.Errorf("warnings got %v, want %v", result.Warnings, tt.wantWarnings)
+			}
+			if result.Valid != (len(tt.wantErrors) == 0) {
+				t.Errorf("valid got %v, want %v", result.Valid, len(tt.wantErrors) == 0)
+			}
+		})
+	}
+}
+
+func helperIssuePaths(issues []entity.LabValidationIssue) []string {
+	paths := []string{}
+	for _, issue := range issues {
+		paths = append(paths, issue.Path)
+	}
+	return paths
+}
+
+func helperNonNil(paths []string) []string {
+	if paths == nil {
+		return []string{}
+	}
+	return paths
+}
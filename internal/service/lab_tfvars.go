@@ -0,0 +1,202 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"one-click-aks-server/internal/entity"
+	"one-click-aks-server/internal/helper"
+
+	"github.com/Rican7/conjson/transform"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// helperTfvarsJSON renders variables as terraform .tfvars.json file.
+func helperTfvarsJSON(variables []entity.TfvarVariable) (string, error) {
+	var out bytes.Buffer
+	out.WriteString("{")
+	for i, variable := range variables {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		name, _ := json.Marshal(variable.Name)
+		out.WriteString("\n  " + string(name) + ": ")
+		if err := json.Indent(&out, []byte(variable.Value), "  ", "  "); err != nil {
+			return "", fmt.Errorf("variable %s: %w", variable.Name, err)
+		}
+	}
+	out.WriteString("\n}\n")
+	return out.String(), nil
+}
+
+// helperTfvarsHCL renders variables as terraform .tfvars file.
+func helperTfvarsHCL(variables []entity.TfvarVariable) (string, error) {
+	var out bytes.Buffer
+	for _, variable := range variables {
+		decoder := json.NewDecoder(strings.NewReader(variable.Value))
+		decoder.UseNumber()
+
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			return "", fmt.Errorf("variable %s: %w", variable.Name, err)
+		}
+
+		out.WriteString(variable.Name + " = ")
+		helperWriteHCLValue(&out, value, "")
+		out.WriteString("\n")
+	}
+	return out.String(), nil
+}
+
+func helperWriteHCLValue(out *bytes.Buffer, value interface{}, indent string) {
+	switch v := value.(type) {
+	case nil:
+		out.WriteString("null")
+	case bool:
+		out.WriteString(strconv.FormatBool(v))
+	case json.Number:
+		out.WriteString(v.String())
+	case string:
+		out.WriteString(helperHCLString(v))
+	case []interface{}:
+		if len(v) == 0 {
+			out.WriteString("[]")
+			return
+		}
+		out.WriteString("[\n")
+		for _, item := range v {
+			out.WriteString(indent + "  ")
+			helperWriteHCLValue(out, item, indent+"  ")
+			out.WriteString(",\n")
+		}
+		out.WriteString(indent + "]")
+	case map[string]interface{}:
+		if len(v) == 0 {
+			out.WriteString("{}")
+			return
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		out.WriteString("{\n")
+		for _, key := range keys {
+			name := key
+			if !helperHCLIdentifier(key) {
+				name = helperHCLString(key)
+			}
+			out.WriteString(indent + "  " + name + " = ")
+			helperWriteHCLValue(out, v[key], indent+"  ")
+			out.WriteString("\n")
+		}
+		out.WriteString(indent + "}")
+	}
+}
+
+// quoted HCL string. Template sequences are escaped so values are taken literally.
+func helperHCLString(s string) string {
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+
+	quoted := strings.ReplaceAll(strings.TrimSuffix(encoded.String(), "\n"), "${", "$${")
+	return strings.ReplaceAll(quoted, "%{", "%%{")
+}
+
+func helperHCLIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if unicode.IsLetter(r) || r == '_' || (i > 0 && (unicode.IsDigit(r) || r == '-')) {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// helperParseTfvarsJSON reads variables of terraform .tfvars.json file.
+func helperParseTfvarsJSON(data []byte) ([]entity.TfvarVariable, error) {
+	values := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+
+	variables := []entity.TfvarVariable{}
+	for name, value := range values {
+		variables = append(variables, entity.TfvarVariable{Name: name, Value: string(value)})
+	}
+	return variables, nil
+}
+
+// helperParseTfvarsHCL reads variables of terraform .tfvars file. Values are evaluated without
+// variables or functions, as terraform does for tfvars files.
+func helperParseTfvarsHCL(data []byte) ([]entity.TfvarVariable, error) {
+	file, diags := hclsyntax.ParseConfig(data, "import.tfvars", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	attributes, diags := file.Body.JustAttributes()
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	variables := []entity.TfvarVariable{}
+	for name, attribute := range attributes {
+		value, diags := attribute.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		encoded, err := ctyjson.Marshal(value, value.Type())
+		if err != nil {
+			return nil, fmt.Errorf("variable %s: %w", name, err)
+		}
+		variables = append(variables, entity.TfvarVariable{Name: name, Value: string(encoded)})
+	}
+	return variables, nil
+}
+
+// helperTfvarConfigFromVariables is the reverse of TfvarVariables. Unknown variables and keys are rejected
+// so that typos don't silently fall back to zero values.
+func helperTfvarConfigFromVariables(variables []entity.TfvarVariable) (entity.TfvarConfigType, error) {
+	tfvar := entity.TfvarConfigType{}
+
+	fields := map[string]int{}
+	tr := reflect.TypeOf(tfvar)
+	for i := 0; i < tr.NumField(); i++ {
+		fields[helper.CamelToConventional(tr.Field(i).Name)] = i
+	}
+
+	for _, variable := range variables {
+		i, ok := fields[variable.Name]
+		if !ok {
+			return tfvar, fmt.Errorf("unknown variable %s", variable.Name)
+		}
+
+		data := transform.Bytes([]byte(variable.Value), transform.Unmarshal, transform.ConventionalKeys())
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+
+		value := reflect.New(tr.Field(i).Type)
+		if err := decoder.Decode(value.Interface()); err != nil {
+			return tfvar, fmt.Errorf("variable %s: %w", variable.Name, err)
+		}
+		reflect.ValueOf(&tfvar).Elem().Field(i).Set(value.Elem())
+	}
+
+	return tfvar, nil
+}
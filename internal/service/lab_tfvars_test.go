@@ -0,0 +1,262 @@
+package service
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"one-click-aks-server/internal/entity"
+	"one-click-aks-server/internal/helper"
+)
+
+func TestHelperParseTfvarsHCL(t *testing.T) {
+	tests := []struct {
+		name    string
+		tfvars  string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "literals",
+			tfvars: "a = \"x\"\nb = 10\nc = 1.5\nd = true\ne = null\n",
+			want:   map[string]string{"a": `"x"`, "b": `10`, "c": `1.5`, "d": `true`, "e": `null`},
+		},
+		{
+			name:   "lists and objects",
+			tfvars: "a = [\"x\", \"y\"]\nb = {\n  k = 1\n  \"quoted key\" = [{ n = null }]\n}\nc = []\nd = {}\n",
+			want:   map[string]string{"a": `["x","y"]`, "b": `{"k":1,"quoted key":[{"n":null}]}`, "c": `[]`, "d": `{}`},
+		},
+		{
+			name:   "comments",
+			tfvars: "# hash\n// slashes\n/* block */ a = \"x\" # trailing\n",
+			want:   map[string]string{"a": `"x"`},
+		},
+		{
+			name:   "escaped template sequences are literal",
+			tfvars: `a = "$${b} %%{c} \"d\" \\ \n"`,
+			want:   map[string]string{"a": `"${b} %{c} \"d\" \\ \n"`},
+		},
+		{
+			name:   "heredoc",
+			tfvars: "a = <<EOT\nline\nEOT\n",
+			want:   map[string]string{"a": `"line\n"`},
+		},
+		{
+			name:   "empty file",
+			tfvars: "",
+			want:   map[string]string{},
+		},
+		{
+			name:    "variable reference",
+			tfvars:  "a = var.b\n",
+			wantErr: true,
+		},
+		{
+			name:    "template interpolation",
+			tfvars:  "a = \"${b}\"\n",
+			wantErr: true,
+		},
+		{
+			name:    "function call",
+			tfvars:  "a = upper(\"b\")\n",
+			wantErr: true,
+		},
+		{
+			name:    "block",
+			tfvars:  "a {\n  b = 1\n}\n",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate variable",
+			tfvars:  "a = 1\na = 2\n",
+			wantErr: true,
+		},
+		{
+			name:    "unterminated string",
+			tfvars:  "a = \"b\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			variables, err := helperParseTfvarsHCL([]byte(tt.tfvars))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want error", variables)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := map[string]string{}
+			for _, variable := range variables {
+				got[variable.Name] = variable.Value
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHelperParseTfvarsJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		tfvars  string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "variables",
+			tfvars: `{"a": "x", "b": [1, 2], "c": {"d": null}}`,
+			want:   map[string]string{"a": `"x"`, "b": `[1, 2]`, "c": `{"d": null}`},
+		},
+		{
+			name:    "not an object",
+			tfvars:  `["a"]`,
+			wantErr: true,
+		},
+		{
+			name:    "malformed",
+			tfvars:  `{"a": }`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			variables, err := helperParseTfvarsJSON([]byte(tt.tfvars))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want error", variables)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := map[string]string{}
+			for _, variable := range variables {
+				got[variable.Name] = variable.Value
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHelperTfvarConfigFromVariablesRejectsUnknown(t *testing.T) {
+	tests := []struct {
+		name      string
+		variables []entity.TfvarVariable
+	}{
+		{
+			name:      "unknown variable",
+			variables: []entity.TfvarVariable{{Name: "resource_groups", Value: `{"location":"eastus"}`}},
+		},
+		{
+			name:      "unknown key",
+			variables: []entity.TfvarVariable{{Name: "resource_group", Value: `{"locaton":"eastus"}`}},
+		},
+		{
+			name:      "wrong type",
+			variables: []entity.TfvarVariable{{Name: "kubernetes_clusters", Value: `{"network_plugin":"azure"}`}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := helperTfvarConfigFromVariables(tt.variables); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
+
+func TestTfvarsExportImportRoundTrip(t *testing.T) {
+	template := entity.TfvarConfigType{
+		ResourceGroup: entity.TfvarResourceGroupType{Location: "East US"},
+		VirtualNetworks: []entity.TfvarVirtualNetworkType{
+			{AddressSpace: []string{"10.1.0.0/16"}},
+		},
+		Subnets: []entity.TfvarSubnetType{
+			{Name: "AzureFirewallSubnet", AddressPrefixes: []string{"10.1.1.0/24"}},
+			{Name: "KubernetesSubnet", AddressPrefixes: []string{"10.1.3.0/24"}},
+		},
+		Jumpservers: []entity.TfvarJumpserverType{
+			{AdminUserName: "azureuser", AdminPassword: `p@ss${word}%{x}"\<>&`},
+		},
+		NetworkSecurityGroups: []entity.TfvarNetworkSecurityGroupType{},
+		KubernetesClusters: []entity.TfvarKubernetesClusterType{
+			{
+				KubernetesVersion:     "1.28.3",
+				NetworkPlugin:         "azure",
+				NetworkPolicy:         "null",
+				NetworkPluginMode:     "overlay",
+				OutboundType:          "userDefinedRouting",
+				PrivateClusterEnabled: "true",
+				OidcIssuerEnabled:     true,
+				Addons: entity.TfvarAddonsType{
+					AppGateway:  true,
+					ServiceMesh: entity.TfvarServiceMeshType{Enabled: true, Mode: "Istio"},
+				},
+				DefaultNodePool: entity.TfvarDefaultNodePoolType{
+					EnableAutoScaling: true,
+					MinCount:          1,
+					MaxCount:          3,
+					VmSize:            "Standard_D2s_v5",
+					OsSku:             "AzureLinux",
+				},
+			},
+		},
+		Firewalls:           []entity.TfvarFirewallType{{SkuName: "AZFW_VNet", SkuTier: "Standard"}},
+		ContainerRegistries: []entity.ContainerRegistryType{{}},
+	}
+
+	tests := []struct {
+		format string
+		render func([]entity.TfvarVariable) (string, error)
+		parse  func([]byte) ([]entity.TfvarVariable, error)
+	}{
+		{entity.TfvarsFormatJSON, helperTfvarsJSON, helperParseTfvarsJSON},
+		{entity.TfvarsFormatHCL, helperTfvarsHCL, helperParseTfvarsHCL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			exported, err := tt.render(helper.TfvarVariables(template))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			variables, err := tt.parse([]byte(exported))
+			if err != nil {
+				t.Fatalf("%v\n%s", err, exported)
+			}
+
+			names := []string{}
+			for _, variable := range variables {
+				names = append(names, variable.Name)
+			}
+			sort.Strings(names)
+			wantNames := []string{"container_registries", "firewalls", "jumpservers", "kubernetes_clusters",
+				"network_security_groups", "resource_group", "subnets", "virtual_networks"}
+			if !reflect.DeepEqual(names, wantNames) {
+				t.Errorf("variables got %v, want %v", names, wantNames)
+			}
+
+			imported, err := helperTfvarConfigFromVariables(variables)
+			if err != nil {
+				t.Fatalf("%v\n%s", err, exported)
+			}
+			if !reflect.DeepEqual(imported, template) {
+				t.Errorf("got %+v, want %+v\n%s", imported, template, exported)
+			}
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package service
 
 import (
-	"encoding/base64"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
 
 	"one-click-aks-server/internal/entity"
 
@@ -18,85 +21,262 @@ func NewLogStreamService(logStreamRepository entity.LogStreamRepository) entity.
 	}
 }
 
-// Appends to already set logs in redis.
+func (l *logStreamService) StartLogStream(operationId string) error {
+	if err := l.logStreamRepository.SetLatestOperationId(operationId); err != nil {
+		slog.Error("not able to set latest log stream operation", err)
+		return err
+	}
+
+	return l.clearOperationLogs(operationId)
+}
+
+func (l *logStreamService) StartBackgroundLogStream(operationId string) error {
+	if err := l.logStreamRepository.AddBackgroundOperationId(operationId); err != nil {
+		slog.Error("not able to add background log stream operation", err)
+		return err
+	}
+
+	return l.clearOperationLogs(operationId)
+}
+
+// Appends to logs of latest operation in redis.
 func (l *logStreamService) AppendLogs(logs string) error {
-	logStream, err := l.GetLogs()
+	operationId, err := l.logStreamRepository.GetLatestOperationId()
 	if err != nil {
-		slog.Debug("not able to get logs from redis. setting new")
-		logStream.Logs = ""
+		slog.Error("not able to get latest log stream operation", err)
+		return err
 	}
 
-	logStream.Logs += logs
+	return l.AppendOperationLogs(operationId, logs)
+}
 
-	return l.SetLogs(logStream.Logs)
+// Appends to logs of the operation in redis and publishes only the new line.
+func (l *logStreamService) AppendOperationLogs(operationId string, logs string) error {
+	seq, err := l.logStreamRepository.AppendLogLine(operationId, logs)
+	if err != nil {
+		slog.Error("not able to append logs in redis", err)
+		return err
+	}
+
+	return l.publishLogLine(entity.LogLine{
+		OperationId: operationId,
+		Seq:         seq,
+		Line:        logs,
+	})
 }
 
 func (l *logStreamService) ClearLogs() error {
 	return l.SetLogs("")
 }
 
-// sets the logs in redis.
+// replaces the logs of latest operation in redis.
 func (l *logStreamService) SetLogs(logs string) error {
 	// this is a hack to continue the logs from where they are right now.
 	if logs == "continue" {
-		prevLogStream, err := l.GetLogs()
-		if err != nil {
-			logs = ""
-		} else {
-			logs = prevLogStream.Logs
-		}
+		return nil
+	}
+
+	operationId, err := l.logStreamRepository.GetLatestOperationId()
+	if err != nil {
+		slog.Error("not able to get latest log stream operation", err)
+		return err
+	}
+
+	if err := l.clearOperationLogs(operationId); err != nil {
+		return err
+	}
+
+	if logs == "" {
+		return nil
 	}
 
-	// encode the logs string and store it in redis.
-	encodedLogs := base64.StdEncoding.EncodeToString([]byte(logs))
-	return l.logStreamRepository.SetLogsInRedis(encodedLogs)
+	return l.AppendOperationLogs(operationId, logs)
 }
 
-// gets the logs from redis and returns the object.
+// gets the logs of latest operation from redis and returns the object.
 func (l *logStreamService) GetLogs() (entity.LogStream, error) {
-	encodedLogs, err := l.logStreamRepository.GetLogsFromRedis()
+	operationId, err := l.logStreamRepository.GetLatestOperationId()
 	if err != nil {
-		slog.Info("not able to get logs from redis")
+		slog.Error("not able to get latest log stream operation", err)
+		return entity.LogStream{}, err
+	}
 
-		// Default to empty.
-		defaultLogStream := entity.LogStream{
-			Logs: "",
-		}
+	return l.GetOperationLogs(operationId)
+}
+
+// gets the logs of the operation from redis assembled as one text.
+func (l *logStreamService) GetOperationLogs(operationId string) (entity.LogStream, error) {
+	lines, err := l.logStreamRepository.GetLogLines(operationId, 1)
+	if err != nil {
+		slog.Error("not able to get logs from redis", err)
+		return entity.LogStream{OperationId: operationId}, err
+	}
+
+	return entity.LogStream{
+		OperationId: operationId,
+		Logs:        strings.Join(lines, ""),
+	}, nil
+}
+
+// sends lines of latest operation after the sequence number and follows
+// the latest operation as new operations are started.
+func (l *logStreamService) StreamLogs(ctx context.Context, operationId string, afterSeq int64, send func(entity.LogLine) error) error {
+	messages, unsubscribe, err := l.logStreamRepository.SubscribeToLatestLogs()
+	if err != nil {
+		slog.Error("not able to subscribe to logs", err)
+		return err
+	}
+	defer unsubscribe()
+
+	latestOperationId, err := l.logStreamRepository.GetLatestOperationId()
+	if err != nil {
+		slog.Error("not able to get latest log stream operation", err)
+		return err
+	}
+
+	// sequence number the client has belongs to an older operation.
+	if operationId != "" && operationId != latestOperationId {
+		afterSeq = 0
+	}
+
+	return l.streamLogLines(ctx, latestOperationId, afterSeq, messages, send)
+}
 
-		if err := l.SetLogs(""); err != nil {
-			slog.Error("not able to set default log stream", err)
-			return defaultLogStream, err
+// sends lines of the operation after the sequence number and then new lines as they are appended.
+func (l *logStreamService) StreamOperationLogs(ctx context.Context, operationId string, afterSeq int64, send func(entity.LogLine) error) error {
+	messages, unsubscribe, err := l.logStreamRepository.SubscribeToLogs(operationId)
+	if err != nil {
+		slog.Error("not able to subscribe to logs of operation", err)
+		return err
+	}
+	defer unsubscribe()
+
+	return l.streamLogLines(ctx, operationId, afterSeq, messages, send)
+}
+
+// subscription must be active before calling this so that lines appended while
+// replaying are not missed. lines that were already sent are skipped and lines
+// missing between published messages are read from redis.
+func (l *logStreamService) streamLogLines(ctx context.Context, operationId string, afterSeq int64, messages <-chan string, send func(entity.LogLine) error) error {
+	lastSeq := afterSeq
+
+	count, err := l.logStreamRepository.GetLogLinesCount(operationId)
+	if err != nil {
+		slog.Error("not able to get logs count from redis", err)
+		return err
+	}
+
+	// logs were cleared since client saw them, client must start over.
+	if lastSeq > count {
+		if err := send(entity.LogLine{OperationId: operationId, Seq: 0}); err != nil {
+			return err
 		}
+		lastSeq = 0
+	}
 
-		return defaultLogStream, nil
+	if err := l.sendLogLinesAfter(operationId, &lastSeq, send); err != nil {
+		return err
 	}
 
-	// decode the logs string and return the object.
-	return helperEncodedStringToLogStreamObject(encodedLogs)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case val, ok := <-messages:
+			if !ok {
+				return errors.New("log stream subscription closed")
+			}
+
+			logLine, err := helperStringToLogLine(val)
+			if err != nil {
+				continue
+			}
+
+			// latest operation changed, follow the new one.
+			if logLine.OperationId != operationId {
+				operationId = logLine.OperationId
+				lastSeq = 0
+			}
+
+			switch {
+			case logLine.Seq == 0:
+				if err := send(logLine); err != nil {
+					return err
+				}
+				lastSeq = 0
+			case logLine.Seq <= lastSeq:
+				// already sent while replaying.
+			case logLine.Seq > lastSeq+1:
+				if err := l.sendLogLinesAfter(operationId, &lastSeq, send); err != nil {
+					return err
+				}
+			default:
+				if err := send(logLine); err != nil {
+					return err
+				}
+				lastSeq = logLine.Seq
+			}
+		}
+	}
 }
 
-// waits for the logs to change and returns the new logs.
-func (l *logStreamService) WaitForLogsChange() (entity.LogStream, error) {
-	logsString, err := l.logStreamRepository.WaitForLogsChange()
+// sends lines of operation stored in redis after lastSeq and moves lastSeq forward.
+func (l *logStreamService) sendLogLinesAfter(operationId string, lastSeq *int64, send func(entity.LogLine) error) error {
+	lines, err := l.logStreamRepository.GetLogLines(operationId, *lastSeq+1)
 	if err != nil {
-		return entity.LogStream{}, err
+		slog.Error("not able to get logs from redis", err)
+		return err
 	}
 
-	return helperEncodedStringToLogStreamObject(logsString)
+	for _, line := range lines {
+		logLine := entity.LogLine{
+			OperationId: operationId,
+			Seq:         *lastSeq + 1,
+			Line:        line,
+		}
+		if err := send(logLine); err != nil {
+			return err
+		}
+		*lastSeq = logLine.Seq
+	}
+
+	return nil
 }
 
-// decodes the encoded string and returns the object.
-func helperEncodedStringToLogStreamObject(encodedLogs string) (entity.LogStream, error) {
-	logBytes, err := base64.StdEncoding.DecodeString(encodedLogs)
+// deletes logs of the operation and lets clients know by sending line with sequence 0.
+func (l *logStreamService) clearOperationLogs(operationId string) error {
+	if err := l.logStreamRepository.DeleteLogLines(operationId); err != nil {
+		slog.Error("not able to delete logs from redis", err)
+		return err
+	}
+
+	return l.publishLogLine(entity.LogLine{
+		OperationId: operationId,
+		Seq:         0,
+	})
+}
+
+func (l *logStreamService) publishLogLine(logLine entity.LogLine) error {
+	val, err := json.Marshal(logLine)
 	if err != nil {
-		slog.Error("not able to decode logs", err)
-		return entity.LogStream{}, err
+		slog.Error("not able to marshal log line", err)
+		return err
 	}
 
-	logs := string(logBytes)
-	logStream := entity.LogStream{
-		Logs: logs,
+	if err := l.logStreamRepository.PublishLogLine(logLine.OperationId, string(val)); err != nil {
+		slog.Error("not able to publish log line", err)
+		return err
+	}
+
+	return nil
+}
+
+func helperStringToLogLine(val string) (entity.LogLine, error) {
+	logLine := entity.LogLine{}
+	if err := json.Unmarshal([]byte(val), &logLine); err != nil {
+		slog.Error("not able to translate log line string to object", err)
+		return logLine, err
 	}
 
-	return logStream, nil
+	return logLine, nil
 }
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"time"
+
+	"one-click-aks-server/internal/entity"
+
+	"github.com/google/uuid"
+	"golang.org/x/exp/slog"
+)
+
+type operationService struct {
+	operationRepository entity.OperationRepository
+}
+
+func NewOperationService(operationRepository entity.OperationRepository) entity.OperationService {
+	return &operationService{
+		operationRepository: operationRepository,
+	}
+}
+
+func (o *operationService) GetOperations() ([]entity.Operation, error) {
+	operations := []entity.Operation{}
+
+	vals, err := o.operationRepository.GetOperations()
+	if err != nil {
+		slog.Error("not able to get operations from redis", err)
+		return operations, err
+	}
+
+	for _, val := range vals {
+		operation := entity.Operation{}
+		if err := json.Unmarshal([]byte(val), &operation); err != nil {
+			slog.Error("not able to translate operation string to object", err)
+			continue
+		}
+		operations = append(operations, operation)
+	}
+
+	return operations, nil
+}
+
+func (o *operationService) GetOperation(operationId string) (entity.Operation, error) {
+	operation := entity.Operation{}
+
+	val, err := o.operationRepository.GetOperation(operationId)
+	if err != nil {
+		slog.Debug("operation not found in redis",
+			slog.String("operationId", operationId),
+			slog.String("error", err.Error()),
+		)
+		return operation, err
+	}
+
+	if err := json.Unmarshal([]byte(val), &operation); err != nil {
+		slog.Error("not able to translate operation string to object", err)
+		return operation, err
+	}
+
+	return operation, nil
+}
+
+func (o *operationService) StartOperation(operation entity.Operation) (entity.Operation, error) {
+	if operation.OperationId == "" {
+		operation.OperationId = uuid.New().String()
+	}
+
+	operation.InProgress = true
+	operation.StartTime = time.Now().Unix()
+	operation.EndTime = 0
+	operation.ExitCode = 0
+	operation.Error = ""
+
+	slog.Info("operation started",
+		slog.String("operationId", operation.OperationId),
+		slog.String("action", operation.Action),
+		slog.String("workspace", operation.Workspace),
+	)
+
+	val, err := json.Marshal(operation)
+	if err != nil {
+		slog.Error("not able to marshal operation", err)
+		return operation, err
+	}
+
+	if err := o.operationRepository.AddOperation(operation.OperationId, string(val)); err != nil {
+		slog.Error("not able to add operation in redis", err)
+		return operation, err
+	}
+
+	return operation, nil
+}
+
+func (o *operationService) EndOperation(operation entity.Operation, status entity.DeploymentStatus, actionErr error) (entity.Operation, error) {
+	// attempts were added to the persisted operation while it was running.
+	if persisted, err := o.GetOperation(operation.OperationId); err == nil {
+		operation.Attempts = persisted.Attempts
+	}
+
+	operation.InProgress = false
+	operation.EndTime = time.Now().Unix()
+	operation.Status = status
+	operation.ExitCode = helperExitCode(actionErr)
+	if actionErr != nil {
+		operation.Error = actionErr.Error()
+	}
+
+	slog.Info("operation ended",
+		slog.String("operationId", operation.OperationId),
+		slog.String("action", operation.Action),
+		slog.String("status", string(operation.Status)),
+		slog.Int("exitCode", operation.ExitCode),
+	)
+
+	val, err := json.Marshal(operation)
+	if err != nil {
+		slog.Error("not able to marshal operation", err)
+		return operation, err
+	}
+
+	if err := o.operationRepository.SetOperation(operation.OperationId, string(val)); err != nil {
+		slog.Error("not able to set operation in redis", err)
+		return operation, err
+	}
+
+	return operation, nil
+}
+
+func (o *operationService) RecordAttempt(operationId string, attempt entity.OperationAttempt) error {
+	operation, err := o.GetOperation(operationId)
+	if err != nil {
+		// operations started by server are not persisted.
+		return err
+	}
+
+	operation.Attempts = append(operation.Attempts, attempt)
+
+	val, err := json.Marshal(operation)
+	if err != nil {
+		slog.Error("not able to marshal operation", err)
+		return err
+	}
+
+	if err := o.operationRepository.SetOperation(operation.OperationId, string(val)); err != nil {
+		slog.Error("not able to set operation in redis", err)
+		return err
+	}
+
+	return nil
+}
+
+// exit code of the process that failed the action.
+// -1 is returned if the action failed without the process exiting with a code.
+func helperExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+
+	return -1
+}
@@ -1,10 +1,15 @@
 package service
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"one-click-aks-server/internal/entity"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"golang.org/x/exp/slog"
 )
 
@@ -30,14 +35,7 @@ func (s *storageAccountService) GetStorageAccountName() (string, error) {
 
 func (s *storageAccountService) BreakBlobLease(storageAccountName string, containerName string, workspaceName string) error {
 
-	// If workspace name is default, then blob name is terraform.tfstate
-	// else it is terraform.tfstateenv:<workspaceName>
-	blobName := "terraform.tfstate"
-	if workspaceName != "default" {
-		blobName = "terraform.tfstateenv:" + workspaceName
-	}
-
-	err := s.storageAccountRepository.BreakBlobLease(storageAccountName, containerName, blobName)
+	err := s.storageAccountRepository.BreakBlobLease(storageAccountName, containerName, helperStateBlobName(workspaceName))
 	if err != nil {
 		slog.Error("not able to break blob lease", err)
 
@@ -45,7 +43,7 @@ func (s *storageAccountService) BreakBlobLease(storageAccountName string, contai
 			return errors.New("there is currently no lease on the blob")
 		}
 		if strings.Contains(err.Error(), "RESPONSE 404: 404 The specified blob does not exist.") {
-			return errors.New("the specified blob does not exist")
+			return entity.ErrBlobNotFound
 		}
 
 		return err
@@ -54,3 +52,198 @@ func (s *storageAccountService) BreakBlobLease(storageAccountName string, contai
 	slog.Debug("state lease broken for workspace " + workspaceName + " in storage account " + storageAccountName + " in container " + containerName)
 	return nil
 }
+
+func (s *storageAccountService) GetBlobLease(storageAccountName string, containerName string, workspaceName string) (entity.BlobLease, error) {
+	blobLease, err := s.storageAccountRepository.GetBlobLease(storageAccountName, containerName, helperStateBlobName(workspaceName))
+	if err != nil {
+		slog.Error("not able to get blob lease", err)
+
+		if strings.Contains(err.Error(), "RESPONSE 404") {
+			return entity.BlobLease{}, entity.ErrBlobNotFound
+		}
+
+		return entity.BlobLease{}, err
+	}
+
+	blobLease.WorkspaceName = workspaceName
+	return blobLease, nil
+}
+
+func (s *storageAccountService) AddLeaseBreakAudit(audit entity.LeaseBreakAudit) error {
+	if audit.Id == "" {
+		audit.Id = uuid.New().String()
+	}
+	if audit.BrokenAt == 0 {
+		audit.BrokenAt = time.Now().Unix()
+	}
+
+	val, err := json.Marshal(audit)
+	if err != nil {
+		slog.Error("not able to marshal lease break audit", err)
+		return err
+	}
+
+	slog.Info("state lease broken",
+		slog.String("workspaceName", audit.WorkspaceName),
+		slog.String("lockId", audit.LockId),
+		slog.String("operationId", audit.OperationId),
+		slog.Bool("automatic", audit.Automatic),
+	)
+
+	if err := s.storageAccountRepository.AddLeaseBreakAudit(string(val)); err != nil {
+		slog.Error("not able to add lease break audit", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *storageAccountService) GetLeaseBreakAudits() ([]entity.LeaseBreakAudit, error) {
+	audits := []entity.LeaseBreakAudit{}
+
+	vals, err := s.storageAccountRepository.GetLeaseBreakAudits()
+	if err != nil {
+		slog.Error("not able to get lease break audits", err)
+		return audits, err
+	}
+
+	for _, val := range vals {
+		audit := entity.LeaseBreakAudit{}
+		if err := json.Unmarshal([]byte(val), &audit); err != nil {
+			slog.Error("not able to translate lease break audit string to object", err)
+			continue
+		}
+		audits = append(audits, audit)
+	}
+
+	return audits, nil
+}
+
+func (s *storageAccountService) CreateStateSnapshot(storageAccountName string, containerName string, workspaceName string, action string, operationId string) (entity.StateSnapshot, error) {
+	snapshotId, err := s.storageAccountRepository.CreateBlobSnapshot(storageAccountName, containerName, helperStateBlobName(workspaceName), action, operationId)
+	if err != nil {
+		// nothing is deployed to the workspace yet.
+		if strings.Contains(err.Error(), "RESPONSE 404") {
+			slog.Debug("no state to snapshot for workspace " + workspaceName)
+			return entity.StateSnapshot{}, nil
+		}
+
+		slog.Error("not able to create state snapshot", err)
+		return entity.StateSnapshot{}, err
+	}
+
+	slog.Info("state snapshot created",
+		slog.String("workspaceName", workspaceName),
+		slog.String("snapshotId", snapshotId),
+		slog.String("action", action),
+		slog.String("operationId", operationId),
+	)
+
+	snapshot := entity.StateSnapshot{
+		WorkspaceName: workspaceName,
+		SnapshotId:    snapshotId,
+		Action:        action,
+		OperationId:   operationId,
+	}
+	if createdAt, err := time.Parse(time.RFC3339Nano, snapshotId); err == nil {
+		snapshot.CreatedAt = createdAt.Unix()
+	}
+
+	return snapshot, nil
+}
+
+func (s *storageAccountService) ListStateSnapshots(storageAccountName string, containerName string, workspaceName string) ([]entity.StateSnapshot, error) {
+	snapshots, err := s.storageAccountRepository.ListBlobSnapshots(storageAccountName, containerName, helperStateBlobName(workspaceName))
+	if err != nil {
+		slog.Error("not able to list state snapshots", err)
+		return []entity.StateSnapshot{}, err
+	}
+
+	for i := range snapshots {
+		snapshots[i].WorkspaceName = workspaceName
+	}
+
+	// snapshot ids are times in same format, they sort as strings.
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].SnapshotId > snapshots[j].SnapshotId
+	})
+
+	return snapshots, nil
+}
+
+func (s *storageAccountService) RestoreStateSnapshot(storageAccountName string, containerName string, workspaceName string, snapshotId string) error {
+	blobLease, err := s.GetBlobLease(storageAccountName, containerName, workspaceName)
+	if err != nil {
+		return err
+	}
+	if blobLease.Leased {
+		return entity.ErrBlobLeased
+	}
+
+	// restore can be undone with the snapshot of current state.
+	if _, err := s.CreateStateSnapshot(storageAccountName, containerName, workspaceName, "restore", ""); err != nil {
+		return err
+	}
+
+	if err := s.storageAccountRepository.RestoreBlobSnapshot(storageAccountName, containerName, helperStateBlobName(workspaceName), snapshotId); err != nil {
+		slog.Error("not able to restore state snapshot", err)
+
+		if strings.Contains(err.Error(), "RESPONSE 404") {
+			return fmt.Errorf("%w: snapshot %s of workspace %s", entity.ErrBlobNotFound, snapshotId, workspaceName)
+		}
+
+		return err
+	}
+
+	slog.Info("state snapshot restored",
+		slog.String("workspaceName", workspaceName),
+		slog.String("snapshotId", snapshotId),
+	)
+
+	return nil
+}
+
+func (s *storageAccountService) GetStateResourceCount(storageAccountName string, containerName string, workspaceName string) (int, error) {
+	val, err := s.storageAccountRepository.GetBlob(storageAccountName, containerName, helperStateBlobName(workspaceName))
+	if err != nil {
+		if strings.Contains(err.Error(), "RESPONSE 404") {
+			return 0, entity.ErrBlobNotFound
+		}
+
+		slog.Error("not able to get state blob",
+			slog.String("workspaceName", workspaceName),
+			slog.String("error", err.Error()),
+		)
+		return 0, err
+	}
+
+	return helperStateResourceCount(val)
+}
+
+// counts instances of resources in terraform state, state list has a line for each of them.
+// Only addresses are looked at, state has sensitive values and is never kept.
+func helperStateResourceCount(val string) (int, error) {
+	state := struct {
+		Resources []struct {
+			Instances []json.RawMessage `json:"instances"`
+		} `json:"resources"`
+	}{}
+	if err := json.Unmarshal([]byte(val), &state); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, resource := range state.Resources {
+		count += len(resource.Instances)
+	}
+	return count, nil
+}
+
+// If workspace name is default, then blob name is terraform.tfstate
+// else it is terraform.tfstateenv:<workspaceName>
+func helperStateBlobName(workspaceName string) string {
+	if workspaceName == "default" {
+		return "terraform.tfstate"
+	}
+	return "terraform.tfstateenv:" + workspaceName
+}
@@ -0,0 +1,44 @@
+package service
+
+import "testing"
+
+func TestHelperStateResourceCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   string
+		want    int
+		wantErr bool
+	}{
+		{
+			name: "instances of resources",
+			state: `{"version":4,"serial":3,"outputs":{"password":{"value":"s3cret","type":"string","sensitive":true}},"resources":[
+				{"mode":"managed","type":"azurerm_resource_group","name":"this","instances":[{"attributes":{"name":"rg"}}]},
+				{"mode":"managed","type":"azurerm_subnet","name":"this","instances":[{"index_key":0},{"index_key":1},{"index_key":2}]},
+				{"mode":"data","type":"azurerm_client_config","name":"current","instances":[{"attributes":{}}]}
+			]}`,
+			want: 5,
+		},
+		{
+			name:  "empty state",
+			state: `{"version":4,"serial":1,"resources":[]}`,
+			want:  0,
+		},
+		{
+			name:    "not a state",
+			state:   "<Error/>",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := helperStateResourceCount(tt.state)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err got %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,12 +2,24 @@ package service
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"one-click-aks-server/internal/config"
 	"one-click-aks-server/internal/entity"
+	"one-click-aks-server/internal/helper"
 
+	"github.com/google/uuid"
 	"golang.org/x/exp/slog"
 )
 
@@ -20,6 +32,25 @@ type terraformService struct {
 	kVersionService       entity.KVersionService
 	storageAccountService entity.StorageAccountService // Some information is needed from storage account service.
 	authService           entity.AuthService
+	operationService      entity.OperationService // attempts are recorded on the operation.
+	appConfig             *config.Config
+
+	// processes of running operations, keyed by operation id.
+	processesMu sync.Mutex
+	processes   map[string]*operationProcess
+}
+
+// tracks the process currently running for an operation.
+// an operation may run more than one process, for example apply runs terraform and then the extend script.
+type operationProcess struct {
+	workspace string
+	refCount  int
+	cancelled bool
+	timedOut  bool          // cancelled because deadline passed.
+	timer     *time.Timer   // deadline of the operation, nil if none.
+	stopped   chan struct{} // closed when cancelled or timed out.
+	cmd       *exec.Cmd
+	done      chan struct{} // closed when cmd exits
 }
 
 func NewTerraformService(
@@ -31,6 +62,8 @@ func NewTerraformService(
 	kVersionService entity.KVersionService,
 	storageAccountService entity.StorageAccountService,
 	authService entity.AuthService,
+	operationService entity.OperationService,
+	appConfig *config.Config,
 ) entity.TerraformService {
 	return &terraformService{
 		terraformRepository:   terraformRepository,
@@ -41,23 +74,28 @@ func NewTerraformService(
 		workspaceService:      workspaceService,
 		storageAccountService: storageAccountService,
 		authService:           authService,
+		operationService:      operationService,
+		appConfig:             appConfig,
+		processes:             map[string]*operationProcess{},
 	}
 }
 
-func (t *terraformService) Init() error {
+func (t *terraformService) Init(operation entity.Operation) error {
+	defer t.trackOperation(operation)()
+
 	lab, err := t.labService.GetLabFromRedis()
 	if err != nil {
 		return err
 	}
 
-	if err := helperTerraformAction(t, lab.Template, "init"); err != nil {
+	if err := helperTerraformAction(t, operation, lab.Template, "init"); err != nil {
 		slog.Error("terraform init failed",
 			slog.String("labId", lab.Id),
 			slog.String("labName", lab.Name),
 			slog.String("labType", lab.Type),
 			slog.String("error", err.Error()),
 		)
-		return fmt.Errorf("terraform init failed %s", err.Error())
+		return fmt.Errorf("terraform init failed %w", err)
 	}
 
 	// Invalidate workspace cache
@@ -68,21 +106,104 @@ func (t *terraformService) Init() error {
 	return nil
 }
 
-func (t *terraformService) Plan(lab entity.LabType) error {
-	if err := helperTerraformAction(t, lab.Template, "plan"); err != nil {
+func (t *terraformService) Plan(operation entity.Operation, lab entity.LabType) (entity.PlanResult, error) {
+	defer t.trackOperation(operation)()
+
+	planFile := helperPlanFile(t.appConfig, operation.OperationId)
+	if err := os.MkdirAll(filepath.Dir(planFile), 0755); err != nil {
+		slog.Error("not able to create plans directory",
+			slog.String("error", err.Error()),
+		)
+		return entity.PlanResult{}, err
+	}
+	helperRemoveExpiredPlans(t.appConfig)
+
+	// plan that didn't complete can't be applied, its file is of no use.
+	planned := false
+	defer func() {
+		if !planned {
+			os.Remove(planFile)
+		}
+	}()
+
+	if err := helperTerraformAction(t, operation, lab.Template, "plan", "-out="+planFile); err != nil {
 		slog.Error("terraform plan failed",
 			slog.String("labId", lab.Id),
 			slog.String("labName", lab.Name),
 			slog.String("labType", lab.Type),
 			slog.String("error", err.Error()),
 		)
-		return fmt.Errorf("terraform plan failed %s", err.Error())
+		return entity.PlanResult{}, fmt.Errorf("terraform plan failed %w", err)
 	}
 
-	return nil
+	out, err := t.terraformRepository.ShowPlan(planFile, operation.Workspace)
+	if err != nil {
+		slog.Error("not able to show terraform plan",
+			slog.String("operationId", operation.OperationId),
+			slog.String("error", err.Error()),
+		)
+		return entity.PlanResult{}, fmt.Errorf("not able to read terraform plan %w", err)
+	}
+
+	planResult, err := helperParsePlan(out)
+	if err != nil {
+		slog.Error("not able to parse terraform plan",
+			slog.String("operationId", operation.OperationId),
+			slog.String("error", err.Error()),
+		)
+		return entity.PlanResult{}, fmt.Errorf("not able to parse terraform plan %w", err)
+	}
+
+	planned = true
+	return planResult, nil
 }
 
-func (t *terraformService) Apply(lab entity.LabType) error {
+func (t *terraformService) CheckDrift(operation entity.Operation, lab entity.LabType) (entity.PlanResult, bool, error) {
+	defer t.trackOperation(operation)()
+
+	planFile := helperPlanFile(t.appConfig, operation.OperationId)
+	if err := os.MkdirAll(filepath.Dir(planFile), 0755); err != nil {
+		slog.Error("not able to create plans directory",
+			slog.String("error", err.Error()),
+		)
+		return entity.PlanResult{}, false, err
+	}
+	// plan is only inspected, it's never applied.
+	defer os.Remove(planFile)
+
+	drifted, err := helperPlanChanged(helperTerraformAction(t, operation, lab.Template, "plan", "-detailed-exitcode", "-out="+planFile))
+	if err != nil {
+		slog.Error("terraform plan for drift check failed",
+			slog.String("workspace", operation.Workspace),
+			slog.String("labId", lab.Id),
+			slog.String("error", err.Error()),
+		)
+		return entity.PlanResult{}, false, fmt.Errorf("terraform plan failed %w", err)
+	}
+
+	if !drifted {
+		return entity.PlanResult{}, false, nil
+	}
+
+	out, err := t.terraformRepository.ShowPlan(planFile, operation.Workspace)
+	if err != nil {
+		slog.Error("not able to show terraform plan",
+			slog.String("operationId", operation.OperationId),
+			slog.String("error", err.Error()),
+		)
+		return entity.PlanResult{}, true, fmt.Errorf("not able to read terraform plan %w", err)
+	}
+
+	planResult, err := helperParsePlan(out)
+	if err != nil {
+		return entity.PlanResult{}, true, fmt.Errorf("not able to parse terraform plan %w", err)
+	}
+
+	return planResult, true, nil
+}
+
+func (t *terraformService) Apply(operation entity.Operation, lab entity.LabType) error {
+	defer t.trackOperation(operation)()
 
 	// if lab is assignment, update assignment status to InProgress
 	if lab.Type == "assignment" {
@@ -92,14 +213,33 @@ func (t *terraformService) Apply(lab entity.LabType) error {
 		}
 	}
 
-	if err := helperTerraformAction(t, lab.Template, "apply"); err != nil {
+	if err := t.snapshotState(operation, "apply"); err != nil {
+		return err
+	}
+
+	args := helperTargetArgs(operation)
+	if operation.PlanId != "" {
+		planFile := helperPlanFile(t.appConfig, operation.PlanId)
+		info, err := os.Stat(planFile)
+		if err != nil {
+			return fmt.Errorf("saved plan %s not found", operation.PlanId)
+		}
+		// saved plan can only be applied once, terraform rejects it as stale after.
+		defer os.Remove(planFile)
+		if helperPlanExpired(t.appConfig, info) {
+			return fmt.Errorf("saved plan %s expired, plan again", operation.PlanId)
+		}
+		args = append(args, planFile)
+	}
+
+	if err := helperTerraformAction(t, operation, lab.Template, "apply", args...); err != nil {
 		slog.Error("terraform apply failed",
 			slog.String("labId", lab.Id),
 			slog.String("labName", lab.Name),
 			slog.String("labType", lab.Type),
 			slog.String("error", err.Error()),
 		)
-		return fmt.Errorf("terraform apply failed %s", err.Error())
+		return fmt.Errorf("terraform apply failed %w", err)
 	}
 
 	// Invalidate workspace cache
@@ -107,11 +247,18 @@ func (t *terraformService) Apply(lab entity.LabType) error {
 		return err
 	}
 
-	return t.Extend(lab, "apply")
+	// extend script works on the whole lab.
+	if operation.Targeted {
+		return nil
+	}
+
+	return t.Extend(operation, lab, "apply")
 
 }
 
-func (t *terraformService) Extend(lab entity.LabType, mode string) error {
+func (t *terraformService) Extend(operation entity.Operation, lab entity.LabType, mode string) error {
+	defer t.trackOperation(operation)()
+
 	slog.Info("running extend script",
 		slog.String("labId", lab.Id),
 		slog.String("labName", lab.Name),
@@ -126,7 +273,7 @@ func (t *terraformService) Extend(lab entity.LabType, mode string) error {
 			return err
 		}
 
-		err = helperExecuteScript(t, lab.ExtendScript, mode)
+		err = helperExecuteScript(t, operation, lab.ExtendScript, mode)
 		if err != nil {
 			return err
 		}
@@ -152,28 +299,43 @@ func (t *terraformService) Extend(lab entity.LabType, mode string) error {
 		return nil
 	}
 
-	return helperExecuteScript(t, lab.ExtendScript, mode)
+	return helperExecuteScript(t, operation, lab.ExtendScript, mode)
 }
 
-func (t *terraformService) Destroy(lab entity.LabType) error {
+func (t *terraformService) Destroy(operation entity.Operation, lab entity.LabType) error {
+	defer t.trackOperation(operation)()
+
 	slog.Info("terraform destroy",
 		slog.String("labId", lab.Id),
 		slog.String("labName", lab.Name),
 		slog.String("labType", lab.Type),
 	)
 
-	if err := t.Extend(lab, "destroy"); err != nil {
+	// without targets, terraform would destroy the whole lab.
+	if operation.Targeted && len(operation.Targets) == 0 {
+		return errors.New("targeted destroy has no targets")
+	}
+
+	// extend script may change resources too.
+	if err := t.snapshotState(operation, "destroy"); err != nil {
 		return err
 	}
 
-	if err := helperTerraformAction(t, lab.Template, "destroy"); err != nil {
+	// extend script works on the whole lab.
+	if !operation.Targeted {
+		if err := t.Extend(operation, lab, "destroy"); err != nil {
+			return err
+		}
+	}
+
+	if err := helperTerraformAction(t, operation, lab.Template, "destroy", helperTargetArgs(operation)...); err != nil {
 		slog.Error("terraform destroy failed",
 			slog.String("labId", lab.Id),
 			slog.String("labName", lab.Name),
 			slog.String("labType", lab.Type),
 			slog.String("error", err.Error()),
 		)
-		return fmt.Errorf("terraform destroy failed %s", err.Error())
+		return fmt.Errorf("terraform destroy failed %w", err)
 	}
 
 	// Invalidate workspace cache
@@ -184,6 +346,60 @@ func (t *terraformService) Destroy(lab entity.LabType) error {
 	return nil
 }
 
+func (t *terraformService) ValidateTargets(workspace string, targets []string) error {
+	addresses, err := t.workspaceService.StateList(workspace)
+	if err != nil {
+		return fmt.Errorf("not able to get resources of workspace %s", workspace)
+	}
+
+	for _, target := range targets {
+		found := false
+		for _, address := range addresses {
+			if address == target || strings.HasPrefix(address, target+".") || strings.HasPrefix(address, target+"[") {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("target %s not found in workspace %s", target, workspace)
+		}
+	}
+
+	return nil
+}
+
+func (t *terraformService) Cancel(operationId string) error {
+	t.processesMu.Lock()
+	process, ok := t.processes[operationId]
+	if !ok {
+		t.processesMu.Unlock()
+		return fmt.Errorf("operation %s is not running", operationId)
+	}
+
+	if process.cancelled {
+		t.processesMu.Unlock()
+		return fmt.Errorf("operation %s is already being cancelled", operationId)
+	}
+
+	process.cancelled = true
+	close(process.stopped)
+	// process is only read under the lock, logging to redis is done after releasing it.
+	cmd, done := process.cmd, process.done
+	t.processesMu.Unlock()
+
+	slog.Info("cancelling operation",
+		slog.String("operationId", operationId),
+	)
+	t.logStreamService.AppendOperationLogs(operationId, "Operation cancelled by user.\n")
+
+	// if no process is running, the next step of operation won't start.
+	if cmd != nil {
+		go helperTerminateProcess(cmd, done, time.Duration(t.appConfig.CancelGracePeriodSeconds)*time.Second)
+	}
+
+	return nil
+}
+
 func (t *terraformService) UpdateAssignment(userId string, labId string, status string) error {
 	slog.Info("updating assignment status",
 		slog.String("userId", userId),
@@ -222,7 +438,7 @@ func (t *terraformService) UpdateChallenge(userId string, labId string, status s
 	return nil
 }
 
-func helperTerraformAction(t *terraformService, tfvar entity.TfvarConfigType, action string) error {
+func helperTerraformAction(t *terraformService, operation entity.Operation, tfvar entity.TfvarConfigType, action string, args ...string) error {
 
 	storageAccountName, err := t.storageAccountService.GetStorageAccountName()
 	if err != nil {
@@ -235,34 +451,92 @@ func helperTerraformAction(t *terraformService, tfvar entity.TfvarConfigType, ac
 		}
 	}
 
-	cmd, rPipe, wPipe, err := t.terraformRepository.TerraformAction(tfvar, action, storageAccountName)
-	if err != nil {
-		return err
-	}
+	maxAttempts := t.appConfig.RetryMaxAttempts
+	backoff := time.Duration(t.appConfig.RetryBackoffSeconds) * time.Second
 
-	// Getting current logs.
-	if _, err := t.logStreamService.GetLogs(); err != nil {
-		return err
-	}
+	for attempt := 1; ; attempt++ {
+		if err := t.stopError(operation.OperationId); err != nil {
+			return err
+		}
 
-	// GO routine that takes care of running command and moving logs to redis.
-	go func(input io.ReadCloser) {
-		in := bufio.NewScanner(input)
+		operationAttempt := entity.OperationAttempt{
+			Action:    action,
+			Attempt:   attempt,
+			StartTime: time.Now().Unix(),
+		}
 
-		for in.Scan() {
-			// Appending logs to redis.
-			t.logStreamService.AppendLogs(fmt.Sprintf("%s\n", in.Text()))
+		cmd, rPipe, wPipe, err := t.terraformRepository.TerraformAction(tfvar, action, storageAccountName, operation.Workspace, args...)
+		if err != nil {
+			return err
 		}
-		input.Close()
-	}(rPipe)
 
-	err = cmd.Wait()
-	wPipe.Close()
+		// GO routine that takes care of running command and moving logs to redis.
+		// Sends what was found in output once output ends.
+		outputFindings := make(chan actionOutputFindings, 1)
+		go func(input io.ReadCloser) {
+			findings := actionOutputFindings{}
+			in := bufio.NewScanner(input)
 
-	return err
+			for in.Scan() {
+				// Appending logs to redis.
+				t.logStreamService.AppendOperationLogs(operation.OperationId, fmt.Sprintf("%s\n", in.Text()))
+				// lease on state blob never expires, state lock is only retried once the lease is broken.
+				if strings.Contains(in.Text(), stateLockErrorPattern) {
+					findings.stateLocked = true
+				} else if findings.transientError == "" {
+					findings.transientError = helperTransientErrorPattern(in.Text(), t.appConfig.RetryErrorPatterns)
+				}
+			}
+			input.Close()
+			outputFindings <- findings
+		}(rPipe)
+
+		err = t.waitForProcess(operation.OperationId, cmd, wPipe)
+
+		operationAttempt.EndTime = time.Now().Unix()
+		operationAttempt.ExitCode = helperExitCode(err)
+		leaseBroken := false
+		if err != nil {
+			findings := <-outputFindings
+			operationAttempt.Error = err.Error()
+			operationAttempt.TransientError = findings.transientError
+
+			if findings.stateLocked && t.stopError(operation.OperationId) == nil {
+				leaseBroken = t.handleStateLock(operation)
+			}
+			if leaseBroken && operationAttempt.TransientError == "" {
+				operationAttempt.TransientError = stateLockErrorPattern
+			}
+		}
+
+		// cancelled or timed out operations are never retried.
+		operationAttempt.Retried = (operationAttempt.TransientError != "" || leaseBroken) &&
+			attempt < maxAttempts &&
+			t.stopError(operation.OperationId) == nil
+
+		t.recordAttempt(operation, operationAttempt)
+
+		if !operationAttempt.Retried {
+			return err
+		}
+
+		slog.Info("retrying terraform action after transient error",
+			slog.String("operationId", operation.OperationId),
+			slog.String("action", action),
+			slog.String("transientError", operationAttempt.TransientError),
+			slog.Int("attempt", attempt),
+		)
+		t.logStreamService.AppendOperationLogs(operation.OperationId,
+			fmt.Sprintf("Transient error '%s' found. Retrying in %s, attempt %d of %d.\n", operationAttempt.TransientError, backoff, attempt+1, maxAttempts))
+
+		if err := t.waitForBackoff(operation.OperationId, backoff); err != nil {
+			return err
+		}
+		backoff *= 2
+	}
 }
 
-func helperExecuteScript(t *terraformService, script string, mode string) error {
+func helperExecuteScript(t *terraformService, operation entity.Operation, script string, mode string) error {
 	storageAccountName, err := t.storageAccountService.GetStorageAccountName()
 	if err != nil {
 		slog.Error("not able to get storage account name",
@@ -271,7 +545,11 @@ func helperExecuteScript(t *terraformService, script string, mode string) error
 		return fmt.Errorf("not able to get storage account name")
 	}
 
-	cmd, rPipe, wPipe, err := t.terraformRepository.ExecuteScript(script, mode, storageAccountName)
+	if err := t.stopError(operation.OperationId); err != nil {
+		return err
+	}
+
+	cmd, rPipe, wPipe, err := t.terraformRepository.ExecuteScript(script, mode, storageAccountName, operation.Workspace)
 	if err != nil {
 		slog.Error("not able to run terraform script",
 			slog.String("error", err.Error()),
@@ -284,13 +562,473 @@ func helperExecuteScript(t *terraformService, script string, mode string) error
 		in := bufio.NewScanner(input)
 
 		for in.Scan() {
-			t.logStreamService.AppendLogs(fmt.Sprintf("%s\n", in.Text()))
+			t.logStreamService.AppendOperationLogs(operation.OperationId, fmt.Sprintf("%s\n", in.Text()))
 		}
 		input.Close()
 	}(rPipe)
 
-	err = cmd.Wait()
+	return t.waitForProcess(operation.OperationId, cmd, wPipe)
+}
+
+// Error of plan run with -detailed-exitcode. Exit code 2 means plan succeeded and there are changes.
+func helperPlanChanged(err error) (bool, error) {
+	if err == nil {
+		return false, nil
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 2 {
+		return true, nil
+	}
+	return false, err
+}
+
+func helperTargetArgs(operation entity.Operation) []string {
+	args := []string{}
+	for _, target := range operation.Targets {
+		args = append(args, "-target="+target)
+	}
+	return args
+}
+
+// terraform fails with this when another process holds lease on the state blob.
+const stateLockErrorPattern = "Error acquiring the state lock"
+
+// what was found in output of a terraform action.
+type actionOutputFindings struct {
+	transientError string // first transient error pattern found, empty if none.
+	stateLocked    bool
+}
+
+// first of the patterns found in the line of terraform output, empty if none.
+func helperTransientErrorPattern(line string, patterns []string) string {
+	for _, pattern := range patterns {
+		if strings.Contains(line, pattern) {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// looks up lease on state blob of the workspace when terraform couldn't acquire the state lock.
+// Lease older than configured threshold, and not held by an operation of this server, is stale.
+// Stale lease is broken if auto break is enabled, otherwise user is told how to break it.
+// Returns true if lease was broken.
+func (t *terraformService) handleStateLock(operation entity.Operation) bool {
+	workspace := helperStateWorkspace(operation.Workspace)
+
+	storageAccountName, err := t.storageAccountService.GetStorageAccountName()
+	if err != nil {
+		return false
+	}
+
+	blobLease, err := t.storageAccountService.GetBlobLease(storageAccountName, entity.TfStateContainerName, workspace)
+	if err != nil {
+		slog.Error("not able to get lease of state blob",
+			slog.String("workspace", workspace),
+			slog.String("error", err.Error()),
+		)
+		return false
+	}
+
+	// lock was released since, next attempt may get it.
+	if !blobLease.Leased {
+		return false
+	}
+
+	leaseAge := helper.LeaseAge(blobLease).Round(time.Second)
+	threshold := time.Duration(t.appConfig.StateLockStaleMinutes) * time.Minute
+
+	slog.Info("state of workspace is locked",
+		slog.String("workspace", workspace),
+		slog.String("lockId", blobLease.LockId),
+		slog.String("lockWho", blobLease.LockWho),
+		slog.String("leaseAge", leaseAge.String()),
+	)
+
+	if leaseAge < threshold {
+		t.logStreamService.AppendOperationLogs(operation.OperationId,
+			fmt.Sprintf("State of workspace %s is locked for %s, lock is considered stale after %s.\n", workspace, leaseAge, threshold))
+		return false
+	}
+
+	if t.isWorkspaceBusy(operation.OperationId, operation.Workspace) {
+		t.logStreamService.AppendOperationLogs(operation.OperationId,
+			fmt.Sprintf("State of workspace %s is locked by another operation running on this server.\n", workspace))
+		return false
+	}
+
+	if !t.appConfig.StateLockAutoBreak {
+		message := fmt.Sprintf("State lock of workspace %s is held for %s and looks stale. If no one else is working on this workspace, break it with PUT /storageaccount/breakbloblease/%s", workspace, leaseAge, workspace)
+		t.logStreamService.AppendOperationLogs(operation.OperationId, message+"\n")
+		t.notify(entity.Warning, message, 0)
+		return false
+	}
+
+	if err := t.storageAccountService.BreakBlobLease(storageAccountName, entity.TfStateContainerName, workspace); err != nil {
+		t.logStreamService.AppendOperationLogs(operation.OperationId,
+			fmt.Sprintf("Not able to break stale state lock of workspace %s: %s\n", workspace, err.Error()))
+		return false
+	}
+
+	if err := t.storageAccountService.AddLeaseBreakAudit(entity.LeaseBreakAudit{
+		WorkspaceName:   workspace,
+		BlobName:        blobLease.BlobName,
+		LockId:          blobLease.LockId,
+		LockWho:         blobLease.LockWho,
+		LeaseAgeSeconds: int64(leaseAge.Seconds()),
+		OperationId:     operation.OperationId,
+		Automatic:       true,
+	}); err != nil {
+		slog.Debug("not able to add audit of broken lease",
+			slog.String("workspace", workspace),
+			slog.String("error", err.Error()),
+		)
+	}
+
+	message := fmt.Sprintf("Stale state lock of workspace %s held for %s was broken.", workspace, leaseAge)
+	t.logStreamService.AppendOperationLogs(operation.OperationId, message+"\n")
+	t.notify(entity.Warning, message, 5000)
+
+	return true
+}
+
+// snapshots state of the workspace so that it can be restored if the action goes wrong.
+func (t *terraformService) snapshotState(operation entity.Operation, action string) error {
+	storageAccountName, err := t.storageAccountService.GetStorageAccountName()
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := t.storageAccountService.CreateStateSnapshot(storageAccountName, entity.TfStateContainerName, helperStateWorkspace(operation.Workspace), action, operation.OperationId)
+	if err != nil {
+		return fmt.Errorf("not able to snapshot terraform state before %s %w", action, err)
+	}
+
+	if snapshot.SnapshotId != "" {
+		t.logStreamService.AppendOperationLogs(operation.OperationId, "State snapshot "+snapshot.SnapshotId+" taken before "+action+".\n")
+	}
+	return nil
+}
+
+// state of operation without workspace is in default workspace.
+func helperStateWorkspace(workspace string) string {
+	if workspace == "" {
+		return "default"
+	}
+	return workspace
+}
+
+// true if an operation other than the given one is running on the workspace.
+func (t *terraformService) isWorkspaceBusy(operationId string, workspace string) bool {
+	t.processesMu.Lock()
+	defer t.processesMu.Unlock()
+
+	for id, process := range t.processes {
+		if id != operationId && process.workspace == workspace {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *terraformService) notify(notificationType entity.ServerNotificationType, message string, autoClose int) {
+	notification := entity.ServerNotification{
+		Id:               uuid.New().String(),
+		NotificationType: notificationType,
+		Message:          message,
+		AutoClose:        autoClose,
+	}
+	if err := t.actionStatusService.SetServerNotification(notification); err != nil {
+		slog.Error("error setting server notification ", err)
+	}
+}
+
+// adds attempt to the persisted operation, operations started by server are not persisted.
+func (t *terraformService) recordAttempt(operation entity.Operation, attempt entity.OperationAttempt) {
+	if operation.Background {
+		return
+	}
+
+	if err := t.operationService.RecordAttempt(operation.OperationId, attempt); err != nil {
+		slog.Debug("not able to record attempt of operation",
+			slog.String("operationId", operation.OperationId),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// waits before next attempt, returns early if operation is cancelled or times out.
+func (t *terraformService) waitForBackoff(operationId string, backoff time.Duration) error {
+	t.processesMu.Lock()
+	process, ok := t.processes[operationId]
+	t.processesMu.Unlock()
+	if !ok {
+		time.Sleep(backoff)
+		return nil
+	}
+
+	select {
+	case <-time.After(backoff):
+		return nil
+	case <-process.stopped:
+		return t.stopError(operationId)
+	}
+}
+
+// plan files are kept in root directory, one per plan operation.
+func helperPlanFile(appConfig *config.Config, operationId string) string {
+	return filepath.Join(appConfig.RootDir, "plans", operationId+".tfplan")
+}
+
+func helperPlanExpired(appConfig *config.Config, info fs.FileInfo) bool {
+	expiry := time.Duration(appConfig.PlanExpiryMinutes) * time.Minute
+	return expiry > 0 && time.Since(info.ModTime()) > expiry
+}
+
+// removes plan files that expired before being applied.
+func helperRemoveExpiredPlans(appConfig *config.Config) {
+	planFiles, err := filepath.Glob(helperPlanFile(appConfig, "*"))
+	if err != nil {
+		return
+	}
+
+	for _, planFile := range planFiles {
+		info, err := os.Stat(planFile)
+		if err != nil || !helperPlanExpired(appConfig, info) {
+			continue
+		}
+		if err := os.Remove(planFile); err != nil {
+			slog.Error("not able to remove expired plan",
+				slog.String("planFile", planFile),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+}
+
+// summarizes resource changes from output of 'terraform show -json'.
+func helperParsePlan(out []byte) (entity.PlanResult, error) {
+	plan := struct {
+		ResourceChanges []struct {
+			Address string `json:"address"`
+			Type    string `json:"type"`
+			Change  struct {
+				Actions []string `json:"actions"`
+			} `json:"change"`
+		} `json:"resource_changes"`
+	}{}
+
+	if err := json.Unmarshal(out, &plan); err != nil {
+		return entity.PlanResult{}, err
+	}
+
+	planResult := entity.PlanResult{
+		Create:  []entity.PlanResourceChange{},
+		Update:  []entity.PlanResourceChange{},
+		Replace: []entity.PlanResourceChange{},
+		Delete:  []entity.PlanResourceChange{},
+	}
+
+	for _, resourceChange := range plan.ResourceChanges {
+		change := entity.PlanResourceChange{
+			Address: resourceChange.Address,
+			Type:    resourceChange.Type,
+		}
+
+		actions := resourceChange.Change.Actions
+		switch {
+		case len(actions) == 2:
+			// ["delete", "create"] or ["create", "delete"]
+			planResult.Replace = append(planResult.Replace, change)
+		case len(actions) == 1 && actions[0] == "create":
+			planResult.Create = append(planResult.Create, change)
+		case len(actions) == 1 && actions[0] == "update":
+			planResult.Update = append(planResult.Update, change)
+		case len(actions) == 1 && actions[0] == "delete":
+			planResult.Delete = append(planResult.Delete, change)
+		}
+	}
+
+	planResult.TotalCreate = len(planResult.Create)
+	planResult.TotalUpdate = len(planResult.Update)
+	planResult.TotalReplace = len(planResult.Replace)
+	planResult.TotalDelete = len(planResult.Delete)
+
+	return planResult, nil
+}
+
+// registers the operation as running and returns a function to release it.
+// calls are counted because actions nest, for example destroy runs extend.
+func (t *terraformService) trackOperation(operation entity.Operation) func() {
+	operationId := operation.OperationId
+
+	t.processesMu.Lock()
+	process, ok := t.processes[operationId]
+	if !ok {
+		process = &operationProcess{workspace: operation.Workspace, stopped: make(chan struct{})}
+		t.processes[operationId] = process
+
+		// deadline covers everything the operation runs.
+		if timeout := t.operationTimeout(operation); timeout > 0 {
+			process.timer = time.AfterFunc(timeout, func() {
+				t.timeOut(operationId, timeout)
+			})
+		}
+	}
+	process.refCount++
+	t.processesMu.Unlock()
+
+	// operation gets its own log stream when it starts.
+	if !ok {
+		startLogStream := t.logStreamService.StartLogStream
+		if operation.Background {
+			startLogStream = t.logStreamService.StartBackgroundLogStream
+		}
+		if err := startLogStream(operationId); err != nil {
+			slog.Error("not able to start log stream",
+				slog.String("operationId", operationId),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+
+	return func() {
+		t.processesMu.Lock()
+		defer t.processesMu.Unlock()
+
+		process.refCount--
+		if process.refCount == 0 {
+			if process.timer != nil {
+				process.timer.Stop()
+			}
+			delete(t.processes, operationId)
+		}
+	}
+}
+
+// error the operation must stop with, nil if it's not cancelled.
+func (t *terraformService) stopError(operationId string) error {
+	t.processesMu.Lock()
+	defer t.processesMu.Unlock()
+
+	process, ok := t.processes[operationId]
+	if !ok {
+		return nil
+	}
+	return helperProcessStopError(process)
+}
+
+func helperProcessStopError(process *operationProcess) error {
+	if process.timedOut {
+		return entity.ErrOperationTimedOut
+	}
+	if process.cancelled {
+		return entity.ErrOperationCancelled
+	}
+	return nil
+}
+
+// deadline of the operation from config, 0 if operation has no deadline.
+// extend modes use deadline of extend unless configured on their own.
+func (t *terraformService) operationTimeout(operation entity.Operation) time.Duration {
+	minutes, ok := t.appConfig.OperationTimeoutMinutes[operation.Action]
+	if operation.Action == "extend" {
+		if modeMinutes, ok := t.appConfig.OperationTimeoutMinutes["extend-"+operation.Mode]; ok {
+			minutes = modeMinutes
+		}
+	} else if !ok {
+		return 0
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// terminates the running process of the operation once its deadline passes.
+func (t *terraformService) timeOut(operationId string, timeout time.Duration) {
+	t.processesMu.Lock()
+	process, ok := t.processes[operationId]
+	if !ok || process.cancelled {
+		t.processesMu.Unlock()
+		return
+	}
+
+	process.cancelled = true
+	process.timedOut = true
+	close(process.stopped)
+	cmd, done := process.cmd, process.done
+	t.processesMu.Unlock()
+
+	slog.Info("operation timed out",
+		slog.String("operationId", operationId),
+		slog.String("timeout", timeout.String()),
+	)
+	t.logStreamService.AppendOperationLogs(operationId, "Operation timed out after "+timeout.String()+".\n")
+
+	if cmd != nil {
+		go helperTerminateProcess(cmd, done, time.Duration(t.appConfig.CancelGracePeriodSeconds)*time.Second)
+	}
+}
+
+// waits for the started command to exit while keeping it available for cancellation.
+func (t *terraformService) waitForProcess(operationId string, cmd *exec.Cmd, wPipe *os.File) error {
+	done := make(chan struct{})
+
+	t.processesMu.Lock()
+	process, ok := t.processes[operationId]
+	if ok {
+		process.cmd = cmd
+		process.done = done
+
+		// cancelled while the process was starting.
+		if process.cancelled {
+			go helperTerminateProcess(cmd, done, time.Duration(t.appConfig.CancelGracePeriodSeconds)*time.Second)
+		}
+	}
+	t.processesMu.Unlock()
+
+	err := cmd.Wait()
 	wPipe.Close()
+	close(done)
+
+	t.processesMu.Lock()
+	defer t.processesMu.Unlock()
+	if ok {
+		process.cmd = nil
+		process.done = nil
+		if err := helperProcessStopError(process); err != nil {
+			return err
+		}
+	}
 
 	return err
 }
+
+// sends SIGINT to the process group of the command to let terraform stop gracefully,
+// and SIGKILL if it's still running after the grace period.
+func helperTerminateProcess(cmd *exec.Cmd, done chan struct{}, gracePeriod time.Duration) {
+	pgid := cmd.Process.Pid
+
+	if err := syscall.Kill(-pgid, syscall.SIGINT); err != nil && !errors.Is(err, syscall.ESRCH) {
+		slog.Error("not able to interrupt process group",
+			slog.Int("pgid", pgid),
+			slog.String("error", err.Error()),
+		)
+	}
+
+	select {
+	case <-done:
+		return
+	case <-time.After(gracePeriod):
+	}
+
+	slog.Info("process did not exit within grace period, killing",
+		slog.Int("pgid", pgid),
+	)
+
+	if err := syscall.Kill(-pgid, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+		slog.Error("not able to kill process group",
+			slog.Int("pgid", pgid),
+			slog.String("error", err.Error()),
+		)
+	}
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"one-click-aks-server/internal/config"
+	"one-click-aks-server/internal/entity"
+)
+
+func exitError(t *testing.T, code int) error {
+	t.Helper()
+	err := exec.Command("sh", "-c", fmt.Sprintf("exit %d", code)).Run()
+	if err == nil {
+		t.Fatal("expected command to fail")
+	}
+	return err
+}
+
+func TestHelperPlanChanged(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantChanged bool
+		wantErr     bool
+	}{
+		{"no changes", nil, false, false},
+		{"changes", exitError(t, 2), true, false},
+		{"wrapped changes", fmt.Errorf("plan: %w", exitError(t, 2)), true, false},
+		{"plan failed", exitError(t, 1), false, true},
+		{"not started", errors.New("storage account not found"), false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed, err := helperPlanChanged(tt.err)
+			if changed != tt.wantChanged {
+				t.Errorf("changed got %v, want %v", changed, tt.wantChanged)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err got %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHelperParsePlan(t *testing.T) {
+	tests := []struct {
+		name    string
+		show    string
+		want    map[string][]string // addresses by kind of change.
+		wantErr bool
+	}{
+		{
+			name: "changes",
+			show: `{"format_version":"1.2","resource_changes":[
+				{"address":"azurerm_resource_group.this","type":"azurerm_resource_group","change":{"actions":["create"]}},
+				{"address":"azurerm_subnet.this[0]","type":"azurerm_subnet","change":{"actions":["update"]}},
+				{"address":"azurerm_kubernetes_cluster.this[0]","type":"azurerm_kubernetes_cluster","change":{"actions":["delete","create"]}},
+				{"address":"azurerm_firewall.this[0]","type":"azurerm_firewall","change":{"actions":["create","delete"]}},
+				{"address":"azurerm_linux_virtual_machine.this[0]","type":"azurerm_linux_virtual_machine","change":{"actions":["delete"]}},
+				{"address":"azurerm_virtual_network.this[0]","type":"azurerm_virtual_network","change":{"actions":["no-op"]}},
+				{"address":"data.azurerm_client_config.current","type":"azurerm_client_config","change":{"actions":["read"]}}
+			]}`,
+			want: map[string][]string{
+				"create":  {"azurerm_resource_group.this"},
+				"update":  {"azurerm_subnet.this[0]"},
+				"replace": {"azurerm_kubernetes_cluster.this[0]", "azurerm_firewall.this[0]"},
+				"delete":  {"azurerm_linux_virtual_machine.this[0]"},
+			},
+		},
+		{
+			name: "no changes",
+			show: `{"format_version":"1.2"}`,
+			want: map[string][]string{"create": {}, "update": {}, "replace": {}, "delete": {}},
+		},
+		{
+			name:    "not json",
+			show:    "Error: Failed to load plan file",
+			wantErr: true,
+		},
+	}
+
+	addresses := func(changes []entity.PlanResourceChange) []string {
+		addresses := []string{}
+		for _, change := range changes {
+			addresses = append(addresses, change.Address)
+		}
+		return addresses
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			planResult, err := helperParsePlan([]byte(tt.show))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want error", planResult)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := map[string][]string{
+				"create":  addresses(planResult.Create),
+				"update":  addresses(planResult.Update),
+				"replace": addresses(planResult.Replace),
+				"delete":  addresses(planResult.Delete),
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+
+			totals := []int{planResult.TotalCreate, planResult.TotalUpdate, planResult.TotalReplace, planResult.TotalDelete}
+			wantTotals := []int{len(tt.want["create"]), len(tt.want["update"]), len(tt.want["replace"]), len(tt.want["delete"])}
+			if !reflect.DeepEqual(totals, wantTotals) {
+				t.Errorf("totals got %v, want %v", totals, wantTotals)
+			}
+		})
+	}
+}
+
+func TestHelperTransientErrorPattern(t *testing.T) {
+	patterns := []string{"StatusCode=429", "TooManyRequests", "AnotherOperationInProgress"}
+
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"throttled", `Error: creating Subnet: unexpected status 429 (StatusCode=429) TooManyRequests`, "StatusCode=429"},
+		{"operation in progress", `Code="AnotherOperationInProgress" Message="Another operation on this or dependent resource is in progress."`, "AnotherOperationInProgress"},
+		{"not transient", `Error: creating Kubernetes Cluster: Code="InvalidParameter"`, ""},
+		{"case sensitive", `toomanyrequests`, ""},
+		{"empty line", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := helperTransientErrorPattern(tt.line, patterns); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := helperTransientErrorPattern("TooManyRequests", nil); got != "" {
+		t.Errorf("got %q without patterns, want none", got)
+	}
+}
+
+func TestHelperRemoveExpiredPlans(t *testing.T) {
+	appConfig := &config.Config{RootDir: t.TempDir(), PlanExpiryMinutes: 60}
+
+	expired := helperPlanFile(appConfig, "expired")
+	fresh := helperPlanFile(appConfig, "fresh")
+	for _, planFile := range []string{expired, fresh} {
+		if err := os.MkdirAll(filepath.Dir(planFile), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(planFile, []byte("plan"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-61 * time.Minute)
+	if err := os.Chtimes(expired, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	helperRemoveExpiredPlans(appConfig)
+
+	if _, err := os.Stat(expired); !os.IsNotExist(err) {
+		t.Errorf("expired plan not removed, stat error %v", err)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("fresh plan removed, stat error %v", err)
+	}
+
+	// expiry of zero keeps plans until applied.
+	appConfig.PlanExpiryMinutes = 0
+	if err := os.Chtimes(fresh, old, old); err != nil {
+		t.Fatal(err)
+	}
+	helperRemoveExpiredPlans(appConfig)
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("plan removed without expiry, stat error %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"encoding/json"
 	"strings"
 
 	"one-click-aks-server/internal/entity"
@@ -110,40 +111,230 @@ func (w *workspaceService) Delete(workspace entity.Workspace) error {
 
 	w.workspaceRepository.DeleteListFromRedis()
 	w.workspaceRepository.DeleteResourcesFromRedis()
+	w.workspaceRepository.DeleteOutputsFromRedis()
 	return nil
 }
 
-func (w *workspaceService) Resources() (string, error) {
+func (w *workspaceService) Resources(resourceTypes []string) ([]entity.TerraformResource, error) {
 
-	// Get resources from redis.
-	resources, err := w.workspaceRepository.GetResourcesFromRedis()
-	if err == nil {
-		return resources, err
+	resources := []entity.TerraformResource{}
+
+	// Get resources from redis. Anything that doesn't parse is treated as not found.
+	val, err := w.workspaceRepository.GetResourcesFromRedis()
+	if err != nil || json.Unmarshal([]byte(val), &resources) != nil {
+		// rest of the block executes only if resources not found in redis.
+		storageAccountName, err := w.storageAccountService.GetStorageAccountName()
+		if err != nil {
+			slog.Error("Not able to get storage account name", err)
+			return []entity.TerraformResource{}, err
+		}
+
+		state, err := w.workspaceRepository.Resources(storageAccountName)
+		if err != nil {
+			slog.Error("not able to get resources", err)
+			return []entity.TerraformResource{}, err
+		}
+
+		// state has sensitive values, only what was picked from it is cached.
+		resources, err = helperParseResources(state)
+		if err != nil {
+			slog.Error("not able to translate terraform state to resources", err)
+			return []entity.TerraformResource{}, err
+		}
+
+		if cached, err := json.Marshal(resources); err == nil {
+			w.workspaceRepository.AddResourcesToRedis(string(cached))
+		}
 	}
 
-	// rest of the function executes only if resources not found in redis.
+	if len(resourceTypes) == 0 {
+		return resources, nil
+	}
 
-	storageAccountName, err := w.storageAccountService.GetStorageAccountName()
+	filtered := []entity.TerraformResource{}
+	for _, resource := range resources {
+		for _, resourceType := range resourceTypes {
+			if resource.Type == resourceType {
+				filtered = append(filtered, resource)
+				break
+			}
+		}
+	}
+	return filtered, nil
+}
+
+// Only redacted outputs are cached. Sensitive values are read from state every time they are asked for.
+func (w *workspaceService) Outputs(workspace string, showSensitive bool) (map[string]entity.TerraformOutput, error) {
+	outputs := map[string]entity.TerraformOutput{}
+
+	if !showSensitive {
+		if val, err := w.workspaceRepository.GetOutputsFromRedis(workspace); err == nil {
+			if err := json.Unmarshal([]byte(val), &outputs); err == nil {
+				return outputs, nil
+			}
+		}
+	}
 
+	val, err := w.workspaceRepository.Outputs(workspace)
 	if err != nil {
-		slog.Error("Not able to get storage account name", err)
-		return "", err
+		slog.Error("not able to get terraform outputs",
+			slog.String("workspace", workspace),
+			slog.String("error", err.Error()),
+		)
+		return outputs, err
+	}
+
+	if err := json.Unmarshal([]byte(val), &outputs); err != nil {
+		slog.Error("not able to translate terraform outputs string to object", err)
+		return outputs, err
 	}
-	resources, err = w.workspaceRepository.Resources(storageAccountName)
+
+	redacted := helperRedactOutputs(outputs)
+	if cache, err := json.Marshal(redacted); err == nil {
+		w.workspaceRepository.AddOutputsToRedis(workspace, string(cache))
+	}
+
+	if showSensitive {
+		return outputs, nil
+	}
+	return redacted, nil
+}
+
+// copy of outputs with values of sensitive outputs replaced.
+func helperRedactOutputs(outputs map[string]entity.TerraformOutput) map[string]entity.TerraformOutput {
+	redacted := map[string]entity.TerraformOutput{}
+	for name, output := range outputs {
+		if output.Sensitive {
+			output.Value = "redacted"
+		}
+		redacted[name] = output
+	}
+	return redacted
+}
+
+func (w *workspaceService) StateList(workspace string) ([]string, error) {
+	addresses := []string{}
+
+	val, err := w.workspaceRepository.StateList(workspace)
 	if err != nil {
-		slog.Error("not able to get resources", err)
+		slog.Error("not able to get terraform state list",
+			slog.String("workspace", workspace),
+			slog.String("error", err.Error()),
+		)
+		return addresses, err
+	}
+
+	for _, address := range strings.Split(val, "\n") {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, address)
+		}
 	}
 
-	w.workspaceRepository.AddResourcesToRedis(resources)
-	return resources, err
+	return addresses, nil
 }
 
 func (w *workspaceService) DeleteAllWorkspaceFromRedis() error {
 	w.workspaceRepository.DeleteListFromRedis()
 	w.workspaceRepository.DeleteResourcesFromRedis()
+	w.workspaceRepository.DeleteOutputsFromRedis()
 	return nil
 }
 
+// attributes of resource values that are shown in inventory, if resource has them.
+var resourceKeyAttributes = []string{
+	"name",
+	"resource_group_name",
+	"sku",
+	"sku_name",
+	"sku_tier",
+	"kubernetes_version",
+	"vm_size",
+	"node_count",
+	"address_space",
+	"address_prefixes",
+	"fqdn",
+	"private_fqdn",
+	"ip_address",
+	"private_ip_address",
+}
+
+// shape of state in 'terraform show -json', modules nest.
+type showModule struct {
+	Address   string `json:"address"`
+	Resources []struct {
+		Address         string                 `json:"address"`
+		Mode            string                 `json:"mode"`
+		Type            string                 `json:"type"`
+		Name            string                 `json:"name"`
+		Values          map[string]interface{} `json:"values"`
+		SensitiveValues map[string]interface{} `json:"sensitive_values"`
+	} `json:"resources"`
+	ChildModules []showModule `json:"child_modules"`
+}
+
+// this is a helper function which takes output of 'terraform show -json'
+// and converts to a list of managed resources.
+func helperParseResources(val string) ([]entity.TerraformResource, error) {
+	resources := []entity.TerraformResource{}
+
+	// workspace without state shows no values.
+	state := struct {
+		Values *struct {
+			RootModule showModule `json:"root_module"`
+		} `json:"values"`
+	}{}
+	if err := json.Unmarshal([]byte(val), &state); err != nil {
+		return resources, err
+	}
+	if state.Values == nil {
+		return resources, nil
+	}
+
+	modules := []showModule{state.Values.RootModule}
+	for len(modules) > 0 {
+		module := modules[0]
+		modules = append(modules[1:], module.ChildModules...)
+
+		for _, r := range module.Resources {
+			// data sources aren't resources of the lab.
+			if r.Mode != "managed" {
+				continue
+			}
+
+			resource := entity.TerraformResource{
+				Address:    r.Address,
+				Type:       r.Type,
+				Name:       r.Name,
+				Module:     module.Address,
+				Attributes: map[string]interface{}{},
+			}
+			if id, ok := r.Values["id"].(string); ok {
+				resource.ResourceId = id
+				if strings.HasPrefix(strings.ToLower(id), "/subscriptions/") {
+					resource.PortalUrl = "https://portal.azure.com/#@/resource" + id
+				}
+			}
+			if location, ok := r.Values["location"].(string); ok {
+				resource.Location = location
+			}
+			for _, key := range resourceKeyAttributes {
+				value, ok := r.Values[key]
+				if !ok || value == nil {
+					continue
+				}
+				if sensitive, ok := r.SensitiveValues[key].(bool); ok && sensitive {
+					continue
+				}
+				resource.Attributes[key] = value
+			}
+
+			resources = append(resources, resource)
+		}
+	}
+
+	return resources, nil
+}
+
 // this is a helper function which takes a string (output from the command)
 // and converts to a list of workspaces.
 func helperStringToWorkspaces(val string) []entity.Workspace {
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"one-click-aks-server/internal/entity"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// keeps cached outputs in memory and counts reads of outputs from state.
+type fakeOutputsRepository struct {
+	entity.WorkspaceRepository
+	outputs string
+	cache   map[string]string
+	reads   int
+}
+
+func (f *fakeOutputsRepository) Outputs(workspace string) (string, error) {
+	f.reads++
+	return f.outputs, nil
+}
+
+func (f *fakeOutputsRepository) GetOutputsFromRedis(workspace string) (string, error) {
+	val, ok := f.cache[workspace]
+	if !ok {
+		return "", redis.Nil
+	}
+	return val, nil
+}
+
+func (f *fakeOutputsRepository) AddOutputsToRedis(workspace string, val string) {
+	f.cache[workspace] = val
+}
+
+func TestOutputsCacheHasNoSensitiveValues(t *testing.T) {
+	repository := &fakeOutputsRepository{
+		outputs: `{"password":{"sensitive":true,"type":"string","value":"s3cret"},"fqdn":{"sensitive":false,"type":"string","value":"aks.example.com"}}`,
+		cache:   map[string]string{},
+	}
+	w := &workspaceService{workspaceRepository: repository}
+
+	for _, showSensitive := range []bool{true, false, true} {
+		outputs, err := w.Outputs("lab1", showSensitive)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wantPassword := "redacted"
+		if showSensitive {
+			wantPassword = "s3cret"
+		}
+		if outputs["password"].Value != wantPassword {
+			t.Errorf("showSensitive=%v password got %v, want %v", showSensitive, outputs["password"].Value, wantPassword)
+		}
+		if outputs["fqdn"].Value != "aks.example.com" {
+			t.Errorf("showSensitive=%v fqdn got %v", showSensitive, outputs["fqdn"].Value)
+		}
+		if strings.Contains(repository.cache["lab1"], "s3cret") {
+			t.Fatalf("sensitive value cached: %s", repository.cache["lab1"])
+		}
+	}
+
+	// redacted outputs come from cache, sensitive ones from state every time.
+	if repository.reads != 2 {
+		t.Errorf("outputs read from state %d times, want 2", repository.reads)
+	}
+}
@@ -57,7 +57,8 @@ function change_to_root_dir() {
 
 function changeToTerraformDirectory() {
   log "Changing to terraform directory"
-  cd $ROOT_DIR/tf
+  # terraform_directory is the workspace's own copy of tf when operation runs in a workspace.
+  cd ${root_directory:-$ROOT_DIR}/${terraform_directory:-tf}
 }
 
 function get_aks_credentials() {
@@ -92,7 +93,8 @@ function tf_init() {
   enableSharedKeyAccess
 
   # Initialize terraform only if not.
-  if [[ ! -f .terraform/terraform.tfstate ]] || [[ ! -f .terraform.lock.hcl ]]; then
+  # TF_DATA_DIR is set when operation runs in workspace's own data directory.
+  if [[ ! -f ${TF_DATA_DIR:-.terraform}/terraform.tfstate ]] || [[ ! -f .terraform.lock.hcl ]]; then
     terraform init \
       -migrate-state \
       -backend-config="subscription_id=$subscription_id" \
@@ -1,17 +1,28 @@
 #!/bin/bash
 
 action=$1
+shift
+# remaining args are passed to terraform command of the action.
 
 source $ROOT_DIR/scripts/helper.sh
 
 function plan() {
   log "Planning"
-  terraform plan
+  terraform plan "$@"
+  status=$?
+  # with -detailed-exitcode, 2 means plan succeeded and there are changes.
+  if [ $status -eq 2 ]; then
+    warn "Changes Detected"
+    exit 2
+  elif [ $status -ne 0 ]; then
+    err "Terraform Plan Failed"
+    exit 1
+  fi
 }
 
 function apply() {
   log "Applying"
-  terraform apply -auto-approve
+  terraform apply -auto-approve "$@"
   if [ $? -ne 0 ]; then
     err "Terraform Apply Failed"
     exit 1
@@ -20,7 +31,7 @@ function apply() {
 
 function destroy() {
   log "Destroying"
-  terraform destroy -auto-approve
+  terraform destroy -auto-approve "$@"
   if [ $? -ne 0 ]; then
     err "Terraform Destroy Failed"
     exit 1
@@ -51,18 +62,23 @@ fi
 
 # Delete existing if init
 if [[ "$action" == "init" ]]; then
-  rm -rf .terraform*
+  if [[ -n "$TF_DATA_DIR" ]]; then
+    # lock file is in workspace's own copy of tf directory, which is the current directory.
+    rm -rf "$TF_DATA_DIR" .terraform.lock.hcl
+  else
+    rm -rf .terraform*
+  fi
 fi
 
 # Terraform Init - Sourced from helper script.
 tf_init
 
 if [[ "$action" == "plan" ]]; then
-  plan
+  plan "$@"
 elif [[ "$action" == "apply" ]]; then
-  apply
+  apply "$@"
 elif [[ "$action" == "destroy" ]]; then
-  destroy
+  destroy "$@"
 fi
 
 ok "Terraform Action End"
@@ -33,7 +33,8 @@ function enablePublicNetworkAccess() {
 # We are not using function from helper.sh cause this function needs to be quiet. i.e. no output.
 function init() {
   # Initialize terraform only if not.
-  if [[ ! -f .terraform/terraform.tfstate ]] || [[ ! -f .terraform.lock.hcl ]]; then
+  # TF_DATA_DIR is set when running against workspace's own data directory.
+  if [[ ! -f ${TF_DATA_DIR:-.terraform}/terraform.tfstate ]] || [[ ! -f .terraform.lock.hcl ]]; then
     terraform init \
       -migrate-state \
       -backend-config="subscription_id=$subscription_id" \
@@ -71,7 +72,8 @@ function createWorkspace() {
 }
 
 # Script starts here.
-cd ${ROOT_DIR}/tf
+# terraform_directory is the workspace's own copy of tf when running against a workspace.
+cd ${root_directory:-$ROOT_DIR}/${terraform_directory:-tf}
 
 if [[ "$ARM_SUBSCRIPTION_ID" == "" ]]; then
   export ARM_SUBSCRIPTION_ID=$(az account show --output json --only-show-error | jq -r .id)
@@ -86,4 +88,16 @@ if [[ "$OPTION" == "list" ]]; then
   exit 0
 fi
 
+# Resource addresses in state of workspace set in TF_WORKSPACE.
+if [[ "$OPTION" == "state" ]]; then
+  terraform state list
+  exit $?
+fi
+
+# Outputs of workspace set in TF_WORKSPACE.
+if [[ "$OPTION" == "output" ]]; then
+  terraform output -json
+  exit $?
+fi
+
 terraform workspace $OPTION $WORKSPACE